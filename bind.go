@@ -0,0 +1,451 @@
+// Package goexpress bind fills a struct from the request
+//
+// The JSON body is decoded as per the `json` tags, the bodies with a
+// parser registered via app.BodyParser are decoded by it, the urlencoded
+// and multipart bodies are read as per the `form` tags and the `query`,
+// `param` and `header` tags read the query string, the route params
+// and the request headers. The sources are applied in the same order,
+// so a route param overrides a body value for a field with both tags.
+// A conversion failure is reported as BindErrors and a validation
+// failure as ValidationErrors, see Validate.
+//
+//   type Search struct {
+//     Term    string    `query:"q"`
+//     Page    int       `query:"page"`
+//     Tags    []string  `query:"tag"`
+//     Since   time.Time `query:"since" time_format:"2006-01-02"`
+//     Org     string    `param:"org"`
+//     Token   string    `header:"X-Token"`
+//     Avatar  *File     `form:"avatar"`
+//   }
+package goexpress
+
+import (
+  "encoding"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net/http"
+  "reflect"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// BindError describes a value which could not be bound to a field
+type BindError struct {
+  // Field is the path of the struct field whatever the source, i.e.
+  // Address.Zip or Items[0].Name
+  Field string `json:"field"`
+  // Source is the tag the value was read for: json, form, query, param or header
+  Source string `json:"source"`
+  // Key is the name of the value in the source
+  Key string `json:"key,omitempty"`
+  // Value is the raw value
+  Value string `json:"value,omitempty"`
+  // Err is the conversion error
+  Err error `json:"-"`
+}
+
+// Error returns a readable description of the failure
+func (e *BindError) Error() string {
+  return fmt.Sprintf("cannot bind %s %q value %q to field %s: %v", e.Source, e.Key, e.Value, e.Field, e.Err)
+}
+
+// Unwrap returns the conversion error
+func (e *BindError) Unwrap() error {
+  return e.Err
+}
+
+// MarshalJSON adds the error message to the JSON view of the error
+func (e *BindError) MarshalJSON() ([]byte, error) {
+  type view BindError
+  var message string
+  if e.Err != nil {
+    message = e.Err.Error()
+  }
+  return json.Marshal(struct {
+    *view
+    Message string `json:"message,omitempty"`
+  }{(*view)(e), message})
+}
+
+// BindErrors is the list of field errors of a Bind call
+type BindErrors []*BindError
+
+// Error returns all the field errors joined
+func (e BindErrors) Error() string {
+  messages := make([]string, len(e))
+  for i, err := range e {
+    messages[i] = err.Error()
+  }
+  return strings.Join(messages, "; ")
+}
+
+// HTTPError returns a 400 Bad Request listing the field errors
+func (e BindErrors) HTTPError() *HTTPError {
+  return NewHTTPError(400, "").WithCause(e).WithDetail("errors", []*BindError(e))
+}
+
+// errInvalidBindTarget is returned when Bind is not given a pointer to a struct
+var errInvalidBindTarget = errors.New("goexpress: Bind takes a non nil pointer to a struct")
+
+// binder fills a struct from the request values
+type binder struct {
+  req    *request
+  errors BindErrors
+}
+
+// Bind fills the struct pointed by dst from the request body, query
+// string, route params and headers, see the package docs for the tags
+// The filled struct is validated as per its `validate` tags
+func (req *request) Bind(dst interface{}) error {
+  target := reflect.ValueOf(dst)
+  if target.Kind() != reflect.Ptr || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+    return errInvalidBindTarget
+  }
+  if err := req.ParseBody(); err != nil {
+    return err
+  }
+  b := &binder{req: req}
+  if req.decodesJSON() {
+    if err := req.json.Decode(dst); errors.As(err, new(*HTTPError)) {
+      return bodyError(err, "")
+    } else if err != nil && err != io.EOF {
+      b.errors = append(b.errors, jsonBindError(err, target.Elem().Type()))
+    }
+  } else if req.parser != nil {
+    if err := req.parser.Decode(req.ref.Body, dst); err != nil && err != io.EOF {
+      return bodyError(err, "")
+    }
+  } else {
+    form, err := req.BodyTree()
+    if err != nil {
+      return err
+    }
+    b.bindFiles(target.Elem())
+    b.bindTree(target.Elem(), "form", form, "", "")
+  }
+  query, err := req.QueryTree()
+  if err != nil {
+    return err
+  }
+  b.bindTree(target.Elem(), "query", query, "", "")
+  b.bind(target.Elem(), "param", func(key string) ([]string, bool) {
+    value, found := req.params.keys[key]
+    return []string{value}, found
+  })
+  b.bind(target.Elem(), "header", func(key string) ([]string, bool) {
+    values, found := req.ref.Header[http.CanonicalHeaderKey(key)]
+    return values, found
+  })
+  if len(b.errors) > 0 {
+    return b.errors
+  }
+  return Validate(dst)
+}
+
+// jsonBindError converts a json decoding error to a BindError
+func jsonBindError(err error, target reflect.Type) *BindError {
+  var typeErr *json.UnmarshalTypeError
+  if errors.As(err, &typeErr) {
+    return &BindError{Field: jsonFieldPath(target, typeErr.Field), Source: "json", Key: typeErr.Field, Value: typeErr.Value, Err: err}
+  }
+  return &BindError{Source: "json", Err: err}
+}
+
+// jsonFieldPath converts the dotted path of the json names of a field
+// to the path of the struct field, the unknown names are kept as is
+func jsonFieldPath(target reflect.Type, key string) string {
+  var path []string
+  for _, name := range strings.Split(key, ".") {
+    for target.Kind() == reflect.Ptr || target.Kind() == reflect.Slice || target.Kind() == reflect.Array || target.Kind() == reflect.Map {
+      target = target.Elem()
+    }
+    if target.Kind() != reflect.Struct {
+      path = append(path, name)
+      continue
+    }
+    var found = false
+    for _, field := range reflect.VisibleFields(target) {
+      if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+        continue
+      }
+      jsonName := tagName(field, "json")
+      if jsonName == name || (jsonName == "" && strings.EqualFold(field.Name, name)) {
+        path = append(path, field.Name)
+        target, found = field.Type, true
+        break
+      }
+    }
+    if !found {
+      path = append(path, name)
+    }
+  }
+  return strings.Join(path, ".")
+}
+
+// tagName returns the name of a tag, "" if absent or ignored
+func tagName(field reflect.StructField, tag string) string {
+  name := strings.Split(field.Tag.Get(tag), ",")[0]
+  if name == "-" {
+    return ""
+  }
+  return name
+}
+
+// bind walks the struct fields with the tag and sets the values
+// found by the lookup function
+func (b *binder) bind(target reflect.Value, tag string, lookup func(key string) ([]string, bool)) {
+  targetType := target.Type()
+  for i := 0; i < targetType.NumField(); i++ {
+    field := targetType.Field(i)
+    value := target.Field(i)
+    if field.PkgPath != "" && !field.Anonymous {
+      // unexported
+      continue
+    }
+    name := tagName(field, tag)
+    if name == "" {
+      if field.Anonymous && value.Kind() == reflect.Struct {
+        b.bind(value, tag, lookup)
+      }
+      continue
+    }
+    if isFileType(field.Type) {
+      continue
+    }
+    values, found := lookup(name)
+    if !found || len(values) == 0 {
+      continue
+    }
+    if err := setField(value, values, field.Tag); err != nil {
+      b.errors = append(b.errors, &BindError{
+        Field:  field.Name,
+        Source: tag,
+        Key:    name,
+        Value:  strings.Join(values, ","),
+        Err:    err,
+      })
+    }
+  }
+}
+
+// bindTree walks the struct fields with the tag and sets the values of
+// the nested tree, see QueryTree, the struct, map and slice of struct
+// fields read the nested objects with the same tag
+// The errors name the fields by their path from the bound struct
+func (b *binder) bindTree(target reflect.Value, tag string, tree map[string]interface{}, prefix string, path string) {
+  targetType := target.Type()
+  for i := 0; i < targetType.NumField(); i++ {
+    field := targetType.Field(i)
+    value := target.Field(i)
+    if field.PkgPath != "" && !field.Anonymous {
+      continue
+    }
+    name := tagName(field, tag)
+    if name == "" {
+      if field.Anonymous && value.Kind() == reflect.Struct {
+        b.bindTree(value, tag, tree, prefix, path)
+      }
+      continue
+    }
+    node, found := tree[name]
+    if !found || isFileType(field.Type) {
+      continue
+    }
+    key := name
+    if prefix != "" {
+      key = prefix + "[" + name + "]"
+    }
+    fieldPath := field.Name
+    if path != "" {
+      fieldPath = path + "." + field.Name
+    }
+    if err := b.bindNode(value, field.Tag, tag, key, fieldPath, node); err != nil {
+      b.errors = append(b.errors, &BindError{Field: fieldPath, Source: tag, Key: key, Value: fmt.Sprint(node), Err: err})
+    }
+  }
+}
+
+// bindNode sets a field from a node of the tree
+func (b *binder) bindNode(field reflect.Value, structTag reflect.StructTag, tag string, key string, path string, node interface{}) error {
+  if values, isLeaf := nestedValues(node); isLeaf {
+    return setField(field, values, structTag)
+  }
+  for field.Kind() == reflect.Ptr {
+    if field.IsNil() {
+      field.Set(reflect.New(field.Type().Elem()))
+    }
+    field = field.Elem()
+  }
+  switch value := node.(type) {
+  case map[string]interface{}:
+    if field.Kind() == reflect.Struct && field.Type() != timeType {
+      b.bindTree(field, tag, value, key, path)
+      return nil
+    }
+    if field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String {
+      if field.IsNil() {
+        field.Set(reflect.MakeMap(field.Type()))
+      }
+      for name, child := range value {
+        elem := reflect.New(field.Type().Elem()).Elem()
+        if err := b.bindNode(elem, structTag, tag, key+"["+name+"]", path+"["+name+"]", child); err != nil {
+          return err
+        }
+        field.SetMapIndex(reflect.ValueOf(name).Convert(field.Type().Key()), elem)
+      }
+      return nil
+    }
+  case []interface{}:
+    if field.Kind() == reflect.Slice {
+      slice := reflect.MakeSlice(field.Type(), len(value), len(value))
+      for i, child := range value {
+        if err := b.bindNode(slice.Index(i), structTag, tag, fmt.Sprintf("%s[%d]", key, i), fmt.Sprintf("%s[%d]", path, i), child); err != nil {
+          return err
+        }
+      }
+      field.Set(slice)
+      return nil
+    }
+  }
+  return fmt.Errorf("cannot bind nested values to a field of type %s", field.Type())
+}
+
+var fileType = reflect.TypeOf(&File{})
+
+// isFileType tells if the field holds uploaded files
+func isFileType(t reflect.Type) bool {
+  return t == fileType || (t.Kind() == reflect.Slice && t.Elem() == fileType)
+}
+
+// bindFiles sets the *File and []*File fields with a form tag
+func (b *binder) bindFiles(target reflect.Value) {
+  targetType := target.Type()
+  for i := 0; i < targetType.NumField(); i++ {
+    field := targetType.Field(i)
+    name := tagName(field, "form")
+    if name == "" || !isFileType(field.Type) || field.PkgPath != "" {
+      continue
+    }
+    for _, file := range b.req.files {
+      if file.FormName != name {
+        continue
+      }
+      if field.Type == fileType {
+        target.Field(i).Set(reflect.ValueOf(file))
+        break
+      }
+      target.Field(i).Set(reflect.Append(target.Field(i), reflect.ValueOf(file)))
+    }
+  }
+}
+
+var (
+  timeType        = reflect.TypeOf(time.Time{})
+  durationType    = reflect.TypeOf(time.Duration(0))
+  unmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setField converts the raw values to the field type, slices take all
+// the values and the other types the first one
+func setField(field reflect.Value, values []string, tag reflect.StructTag) error {
+  if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 && !reflect.PtrTo(field.Type()).Implements(unmarshalerType) {
+    slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+    for i, value := range values {
+      if err := setValue(slice.Index(i), value, tag); err != nil {
+        return err
+      }
+    }
+    field.Set(slice)
+    return nil
+  }
+  return setValue(field, values[0], tag)
+}
+
+// setValue converts a single raw value to the field type
+func setValue(field reflect.Value, value string, tag reflect.StructTag) error {
+  if field.Kind() == reflect.Ptr {
+    if field.IsNil() {
+      field.Set(reflect.New(field.Type().Elem()))
+    }
+    return setValue(field.Elem(), value, tag)
+  }
+  if field.CanAddr() && field.Addr().Type().Implements(unmarshalerType) && field.Type() != timeType {
+    return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+  }
+  if value == "" && field.Kind() != reflect.String {
+    // empty form inputs leave the zero value
+    field.Set(reflect.Zero(field.Type()))
+    return nil
+  }
+  switch field.Type() {
+  case timeType:
+    return setTime(field, value, tag.Get("time_format"))
+  case durationType:
+    d, err := time.ParseDuration(value)
+    if err != nil {
+      return err
+    }
+    field.SetInt(int64(d))
+    return nil
+  }
+  switch field.Kind() {
+  case reflect.String:
+    field.SetString(value)
+  case reflect.Bool:
+    b, err := strconv.ParseBool(value)
+    if err != nil {
+      return err
+    }
+    field.SetBool(b)
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+    if err != nil {
+      return err
+    }
+    field.SetInt(i)
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+    if err != nil {
+      return err
+    }
+    field.SetUint(u)
+  case reflect.Float32, reflect.Float64:
+    f, err := strconv.ParseFloat(value, field.Type().Bits())
+    if err != nil {
+      return err
+    }
+    field.SetFloat(f)
+  case reflect.Slice:
+    // []byte
+    field.SetBytes([]byte(value))
+  default:
+    return fmt.Errorf("unsupported field type %s", field.Type())
+  }
+  return nil
+}
+
+// setTime parses a time with the layout, "unix" reads seconds since epoch
+// and the default layout is RFC3339
+func setTime(field reflect.Value, value string, layout string) error {
+  if layout == "unix" {
+    seconds, err := strconv.ParseInt(value, 10, 64)
+    if err != nil {
+      return err
+    }
+    field.Set(reflect.ValueOf(time.Unix(seconds, 0)))
+    return nil
+  }
+  if layout == "" {
+    layout = time.RFC3339
+  }
+  t, err := time.Parse(layout, value)
+  if err != nil {
+    return err
+  }
+  field.Set(reflect.ValueOf(t))
+  return nil
+}
@@ -0,0 +1,122 @@
+package goexpress
+
+import (
+  "encoding/json"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+type bindTarget struct {
+  Name    string        `json:"name" form:"name"`
+  Age     int           `json:"age" form:"age"`
+  Active  bool          `query:"active"`
+  Tags    []string      `query:"tag"`
+  Since   time.Time     `query:"since" time_format:"2006-01-02"`
+  Timeout time.Duration `query:"timeout"`
+  Limit   *uint         `query:"limit"`
+  ID      int64         `param:"id"`
+  Token   string        `header:"x-token"`
+}
+
+func Test_Bind_fills_struct_from_form_query_params_and_headers(t *testing.T) {
+  raw := httptest.NewRequest("POST", "/users/42?active=true&tag=a&tag=b&since=2020-01-02&timeout=2s&limit=5", strings.NewReader("name=rob&age=30"))
+  raw.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  raw.Header.Set("X-Token", "secret")
+  req := newRequest(raw, Express().(*express), newLocals())
+  req.params.Set("id", "42")
+
+  var target bindTarget
+  assert.NoError(t, req.Bind(&target))
+  assert.Equal(t, "rob", target.Name)
+  assert.Equal(t, 30, target.Age)
+  assert.True(t, target.Active)
+  assert.Equal(t, []string{"a", "b"}, target.Tags)
+  assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), target.Since)
+  assert.Equal(t, 2*time.Second, target.Timeout)
+  assert.Equal(t, uint(5), *target.Limit)
+  assert.Equal(t, int64(42), target.ID)
+  assert.Equal(t, "secret", target.Token)
+}
+
+func Test_Bind_reports_field_errors(t *testing.T) {
+  raw := httptest.NewRequest("POST", "/?active=maybe", strings.NewReader(`{"name":"rob","age":"thirty"}`))
+  raw.Header.Set("Content-Type", "application/json")
+  req := newRequest(raw, Express().(*express), newLocals())
+
+  var target bindTarget
+  err := req.Bind(&target)
+  errs, ok := err.(BindErrors)
+  if assert.True(t, ok) && assert.Len(t, errs, 2) {
+    assert.Equal(t, "json", errs[0].Source)
+    assert.Equal(t, "Age", errs[0].Field)
+    assert.Equal(t, "age", errs[0].Key)
+    assert.Equal(t, "query", errs[1].Source)
+    assert.Equal(t, "Active", errs[1].Field)
+    assert.Equal(t, "maybe", errs[1].Value)
+  }
+  assert.Equal(t, 400, toHTTPError(err).Status)
+  assert.Equal(t, errInvalidBindTarget, req.Bind(target))
+}
+
+func Test_BindError_names_the_struct_field_of_every_source(t *testing.T) {
+  var target struct {
+    Address struct {
+      Zip int `json:"zip" query:"zip"`
+    } `json:"address" query:"address"`
+  }
+  raw := httptest.NewRequest("POST", "/", strings.NewReader(`{"address":{"zip":"abc"}}`))
+  raw.Header.Set("Content-Type", "application/json")
+  req := newRequest(raw, Express().(*express), newLocals())
+  errs, _ := req.Bind(&target).(BindErrors)
+  if assert.Len(t, errs, 1) {
+    assert.Equal(t, "Address.Zip", errs[0].Field)
+    assert.Equal(t, "address.zip", errs[0].Key)
+  }
+
+  raw = httptest.NewRequest("GET", "/?address[zip]=abc", nil)
+  req = newRequest(raw, Express().(*express), newLocals())
+  errs, _ = req.Bind(&target).(BindErrors)
+  if assert.Len(t, errs, 1) {
+    assert.Equal(t, "Address.Zip", errs[0].Field)
+    assert.Equal(t, "address[zip]", errs[0].Key)
+  }
+
+  encoded, err := json.Marshal(&BindError{Field: "Name", Source: "form"})
+  assert.NoError(t, err)
+  assert.JSONEq(t, `{"field":"Name","source":"form"}`, string(encoded))
+}
+
+func Test_QueryTree_parses_nested_keys_and_binds_them(t *testing.T) {
+  raw := httptest.NewRequest("GET", "/?filter[status]=open&filter[tags][]=a&filter[tags][]=b&sort[]=-created&ids[1]=y&ids[0]=x", nil)
+  req := newRequest(raw, Express().(*express), newLocals())
+  tree, err := req.QueryTree()
+  assert.NoError(t, err)
+  assert.Equal(t, map[string]interface{}{
+    "filter": map[string]interface{}{"status": "open", "tags": []interface{}{"a", "b"}},
+    "sort":   []interface{}{"-created"},
+    "ids":    []interface{}{"x", "y"},
+  }, tree)
+
+  var target struct {
+    Filter struct {
+      Status string   `query:"status"`
+      Tags   []string `query:"tags"`
+    } `query:"filter"`
+    Sort []string `query:"sort"`
+    IDs  []string `query:"ids"`
+  }
+  assert.NoError(t, req.Bind(&target))
+  assert.Equal(t, "open", target.Filter.Status)
+  assert.Equal(t, []string{"a", "b"}, target.Filter.Tags)
+  assert.Equal(t, []string{"-created"}, target.Sort)
+  assert.Equal(t, []string{"x", "y"}, target.IDs)
+
+  raw = httptest.NewRequest("GET", "/?a[b][c][d][e][f][g]=1", nil)
+  req = newRequest(raw, Express().(*express), newLocals())
+  _, err = req.QueryTree()
+  assert.Equal(t, 400, toHTTPError(err).Status)
+}
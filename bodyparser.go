@@ -0,0 +1,287 @@
+// Package goexpress bodyparser keeps the registry of the request body
+// parsers keyed by media type along with the charset decoders
+//
+// JSON and XML are built-in, any other format is plugged in by
+// registering a BodyParser on the app, i.e. for MessagePack
+//
+//   app.BodyParser("application/msgpack", BodyParserFunc(func(body io.Reader, v interface{}) error {
+//     return msgpack.NewDecoder(body).Decode(v)
+//   }))
+//
+// A parser registered for "application/json" also handles the structured
+// syntax suffix types like "application/merge-patch+json", and one for
+// "text/*" handles every text type without a parser of its own.
+package goexpress
+
+import (
+  "encoding/json"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "mime"
+  "strings"
+  "sync"
+  "unicode/utf16"
+  "unicode/utf8"
+)
+
+// BodyParser decodes a request body into a value
+type BodyParser interface {
+  Decode(body io.Reader, v interface{}) error
+}
+
+// BodyParserFunc adapts a function to a BodyParser
+type BodyParserFunc func(body io.Reader, v interface{}) error
+
+// Decode calls the function
+func (f BodyParserFunc) Decode(body io.Reader, v interface{}) error {
+  return f(body, v)
+}
+
+// jsonMediaType is the media type handled by the request json decoder
+const jsonMediaType = "application/json"
+
+// jsonParser is the built-in JSON parser, the requests it is registered
+// for decode with their JSON decoder instead
+type jsonParser struct{}
+
+func (jsonParser) Decode(body io.Reader, v interface{}) error {
+  return json.NewDecoder(body).Decode(v)
+}
+
+// JSONParser decodes JSON bodies
+var JSONParser BodyParser = jsonParser{}
+
+// XMLParser decodes XML bodies, the encodings declared in the XML
+// prolog are read with the registered charset decoders
+var XMLParser = BodyParserFunc(func(body io.Reader, v interface{}) error {
+  decoder := xml.NewDecoder(body)
+  decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+    decode, found := charsetDecoder(charset)
+    if !found {
+      return nil, fmt.Errorf("unsupported charset %s", charset)
+    }
+    if decode == nil {
+      return input, nil
+    }
+    return decode(input), nil
+  }
+  return decoder.Decode(v)
+})
+
+// bodyParsers is a registry of body parsers keyed by media type
+type bodyParsers struct {
+  mutex   sync.RWMutex
+  parsers map[string]BodyParser
+}
+
+// newBodyParsers returns the registry with the built-in parsers
+func newBodyParsers() *bodyParsers {
+  p := &bodyParsers{parsers: make(map[string]BodyParser)}
+  p.parsers[jsonMediaType] = JSONParser
+  p.parsers["application/xml"] = XMLParser
+  p.parsers["text/xml"] = XMLParser
+  return p
+}
+
+// set registers a parser for a media type
+func (p *bodyParsers) set(mediaType string, parser BodyParser) {
+  p.mutex.Lock()
+  p.parsers[strings.ToLower(mediaType)] = parser
+  p.mutex.Unlock()
+}
+
+// lookup returns the parser of a media type along with the media type it
+// was registered for, trying the exact type, the structured syntax suffix
+// and the type wildcard in order
+func (p *bodyParsers) lookup(mediaType string) (BodyParser, string) {
+  if mediaType == "" {
+    return nil, ""
+  }
+  var candidates = []string{mediaType}
+  parts := strings.SplitN(mediaType, "/", 2)
+  if len(parts) == 2 {
+    if index := strings.LastIndex(parts[1], "+"); index != -1 {
+      candidates = append(candidates, "application/"+parts[1][index+1:])
+    }
+    candidates = append(candidates, parts[0]+"/*")
+  }
+  p.mutex.RLock()
+  defer p.mutex.RUnlock()
+  for _, candidate := range candidates {
+    if parser, found := p.parsers[candidate]; found {
+      return parser, candidate
+    }
+  }
+  return nil, ""
+}
+
+// parseMediaType returns the lowercased media type and its parameters,
+// a header which does not parse yields the part before the first ";"
+func parseMediaType(header string) (string, map[string]string) {
+  if header == "" {
+    return "", map[string]string{}
+  }
+  mediaType, params, err := mime.ParseMediaType(header)
+  if err != nil {
+    return strings.ToLower(strings.TrimSpace(strings.Split(header, ";")[0])), map[string]string{}
+  }
+  return mediaType, params
+}
+
+// CharsetDecoder returns a reader converting the body to UTF-8
+type CharsetDecoder func(body io.Reader) io.Reader
+
+var (
+  charsetMutex sync.RWMutex
+  charsets     = map[string]CharsetDecoder{
+    "utf-8":      nil,
+    "utf8":       nil,
+    "us-ascii":   nil,
+    "iso-8859-1": newLatin1Reader,
+    "latin1":     newLatin1Reader,
+    "utf-16":     newUTF16Reader(false),
+    "utf-16le":   newUTF16Reader(false),
+    "utf-16be":   newUTF16Reader(true),
+  }
+)
+
+// RegisterCharset adds a decoder for a body charset, i.e. from golang.org/x/text
+//
+//   RegisterCharset("windows-1252", charmap.Windows1252.NewDecoder().Reader)
+func RegisterCharset(name string, decoder CharsetDecoder) {
+  charsetMutex.Lock()
+  charsets[strings.ToLower(name)] = decoder
+  charsetMutex.Unlock()
+}
+
+// charsetDecoder returns the decoder of a charset, a nil decoder means
+// the body is already UTF-8 and found is false for unknown charsets
+func charsetDecoder(name string) (decoder CharsetDecoder, found bool) {
+  if name == "" {
+    return nil, true
+  }
+  charsetMutex.RLock()
+  decoder, found = charsets[strings.ToLower(name)]
+  charsetMutex.RUnlock()
+  return decoder, found
+}
+
+// latin1Reader converts ISO-8859-1 bytes to UTF-8
+type latin1Reader struct {
+  source  io.Reader
+  pending []byte
+}
+
+func newLatin1Reader(body io.Reader) io.Reader {
+  return &latin1Reader{source: body}
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+  if len(r.pending) == 0 {
+    // every latin1 byte takes at most two bytes in UTF-8
+    raw := make([]byte, len(p)/2+1)
+    n, err := r.source.Read(raw)
+    for _, b := range raw[:n] {
+      r.pending = utf8.AppendRune(r.pending, rune(b))
+    }
+    if n == 0 {
+      return 0, err
+    }
+  }
+  n := copy(p, r.pending)
+  r.pending = r.pending[n:]
+  return n, nil
+}
+
+// utf16Reader converts UTF-16 bytes to UTF-8 as they are read
+type utf16Reader struct {
+  source    io.Reader
+  bigEndian bool
+  started   bool   // the byte order mark was looked for
+  raw       []byte // bytes read but not decoded yet
+  pending   []byte
+  err       error
+}
+
+// newUTF16Reader returns a decoder of the UTF-16 bodies, a byte order
+// mark overrides the default endianness
+func newUTF16Reader(bigEndian bool) CharsetDecoder {
+  return func(body io.Reader) io.Reader {
+    return &utf16Reader{source: body, bigEndian: bigEndian}
+  }
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+  for len(r.pending) == 0 {
+    if r.err != nil {
+      return 0, r.err
+    }
+    var chunk [4096]byte
+    n, err := r.source.Read(chunk[:])
+    r.raw = append(r.raw, chunk[:n]...)
+    r.err = err
+    r.decode(err != nil)
+  }
+  n := copy(p, r.pending)
+  r.pending = r.pending[n:]
+  return n, nil
+}
+
+// decode converts the complete code units of raw, a surrogate pair cut
+// by the end of a read is kept until the next one unless final
+func (r *utf16Reader) decode(final bool) {
+  if !r.started {
+    if len(r.raw) < 2 && !final {
+      return
+    }
+    r.started = true
+    if len(r.raw) >= 2 && r.raw[0] == 0xFE && r.raw[1] == 0xFF {
+      r.bigEndian, r.raw = true, r.raw[2:]
+    } else if len(r.raw) >= 2 && r.raw[0] == 0xFF && r.raw[1] == 0xFE {
+      r.bigEndian, r.raw = false, r.raw[2:]
+    }
+  }
+  for len(r.raw) >= 2 {
+    unit := r.unit(0)
+    if utf16.IsSurrogate(unit) && unit < 0xDC00 {
+      if len(r.raw) < 4 && !final {
+        return
+      }
+      if len(r.raw) >= 4 {
+        if decoded := utf16.DecodeRune(unit, r.unit(2)); decoded != utf8.RuneError {
+          r.pending = utf8.AppendRune(r.pending, decoded)
+          r.raw = r.raw[4:]
+          continue
+        }
+      }
+    }
+    if utf16.IsSurrogate(unit) {
+      unit = utf8.RuneError
+    }
+    r.pending = utf8.AppendRune(r.pending, unit)
+    r.raw = r.raw[2:]
+  }
+  if final && len(r.raw) > 0 {
+    // a dangling byte
+    r.pending = utf8.AppendRune(r.pending, utf8.RuneError)
+    r.raw = nil
+  }
+}
+
+// unit returns the code unit at offset of raw
+func (r *utf16Reader) unit(offset int) rune {
+  if r.bigEndian {
+    return rune(r.raw[offset])<<8 | rune(r.raw[offset+1])
+  }
+  return rune(r.raw[offset+1])<<8 | rune(r.raw[offset])
+}
+
+// errorReader fails every read with the error
+type errorReader struct {
+  err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+  return 0, r.err
+}
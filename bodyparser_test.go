@@ -0,0 +1,238 @@
+package goexpress
+
+import (
+  "bytes"
+  "compress/gzip"
+  "io"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "testing/iotest"
+
+  "github.com/andybalholm/brotli"
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_newRequest_decodes_json_variants(t *testing.T) {
+  for _, contentType := range []string{"application/json; charset=utf-8", "application/merge-patch+json", "Application/JSON"} {
+    raw := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name":"rob"}`))
+    raw.Header.Set("Content-Type", contentType)
+    req := newRequest(raw, Express().(*express), newLocals())
+    assert.True(t, req.IsJSON(), contentType)
+    var body map[string]string
+    assert.NoError(t, req.JSON().Decode(&body))
+    assert.Equal(t, "rob", body["name"])
+  }
+}
+
+func Test_newRequest_decodes_body_charsets(t *testing.T) {
+  raw := httptest.NewRequest("POST", "/", strings.NewReader("name=Ren\xe9"))
+  raw.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=ISO-8859-1")
+  req := newRequest(raw, Express().(*express), newLocals())
+  assert.Equal(t, []string{"René"}, req.Body("name"))
+
+  raw = httptest.NewRequest("POST", "/", strings.NewReader("\xff\xfe{\x00}\x00"))
+  raw.Header.Set("Content-Type", "application/json; charset=utf-16")
+  req = newRequest(raw, Express().(*express), newLocals())
+  var body map[string]string
+  assert.NoError(t, req.JSON().Decode(&body))
+
+  raw = httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+  raw.Header.Set("Content-Type", "application/json; charset=klingon")
+  req = newRequest(raw, Express().(*express), newLocals())
+  var target bindTarget
+  assert.Equal(t, 415, toHTTPError(req.Bind(&target)).Status)
+}
+
+func Test_newUTF16Reader_streams_the_body(t *testing.T) {
+  // "a😀" in UTF-16BE with a byte order mark, read a byte at a time so
+  // the surrogate pair is split across reads
+  encoded := "\xfe\xff\x00a\xd8\x3d\xde\x00"
+  decoded, err := io.ReadAll(newUTF16Reader(false)(iotest.OneByteReader(strings.NewReader(encoded))))
+  assert.NoError(t, err)
+  assert.Equal(t, "a\U0001F600", string(decoded))
+
+  body := &countingReader{Reader: strings.NewReader(strings.Repeat("a\x00", 5<<20))}
+  reader := newUTF16Reader(false)(body)
+  head := make([]byte, 4)
+  _, err = io.ReadFull(reader, head)
+  assert.NoError(t, err)
+  assert.Equal(t, "aaaa", string(head))
+  assert.Less(t, body.read, 64<<10)
+}
+
+func Test_bodyParsers_lookup_falls_back_to_suffix_and_wildcard(t *testing.T) {
+  parsers := newBodyParsers()
+  parsers.set("text/*", JSONParser)
+  _, mediaType := parsers.lookup("application/vnd.api+json")
+  assert.Equal(t, "application/json", mediaType)
+  _, mediaType = parsers.lookup("text/csv")
+  assert.Equal(t, "text/*", mediaType)
+  parser, _ := parsers.lookup("application/octet-stream")
+  assert.Nil(t, parser)
+}
+
+func Test_Decode_dispatches_on_media_type(t *testing.T) {
+  type order struct {
+    ID   int    `xml:"id"`
+    Item string `xml:"item"`
+  }
+  raw := httptest.NewRequest("POST", "/", strings.NewReader(`<order><id>7</id><item>book</item></order>`))
+  raw.Header.Set("Content-Type", "application/vnd.partner+xml")
+  req := newRequest(raw, Express().(*express), newLocals())
+  var o order
+  assert.NoError(t, req.Decode(&o))
+  assert.Equal(t, order{ID: 7, Item: "book"}, o)
+
+  raw = httptest.NewRequest("POST", "/", strings.NewReader("raw"))
+  raw.Header.Set("Content-Type", "application/octet-stream")
+  req = newRequest(raw, Express().(*express), newLocals())
+  assert.Equal(t, 415, toHTTPError(req.Decode(&o)).Status)
+}
+
+func Test_Decode_uses_the_parser_registered_for_json(t *testing.T) {
+  app := Express().(*express)
+  app.BodyParser("application/json", BodyParserFunc(func(body io.Reader, v interface{}) error {
+    (*v.(*map[string]string))["parser"] = "custom"
+    return nil
+  }))
+  raw := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"rob"}`))
+  raw.Header.Set("Content-Type", "application/json")
+  req := newRequest(raw, app, newLocals())
+  var body = map[string]string{}
+  assert.NoError(t, req.Decode(&body))
+  assert.Equal(t, map[string]string{"parser": "custom"}, body)
+  assert.True(t, req.IsJSON())
+}
+
+// countingReader counts the bytes read from the body
+type countingReader struct {
+  io.Reader
+  read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+  n, err := c.Reader.Read(p)
+  c.read += n
+  return n, err
+}
+
+func Test_newRequest_defers_body_parsing(t *testing.T) {
+  body := &countingReader{Reader: strings.NewReader("name=rob")}
+  raw := httptest.NewRequest("POST", "/", body)
+  raw.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  req := newRequest(raw, Express().(*express), newLocals())
+  assert.False(t, req.IsJSON())
+  assert.Equal(t, 0, body.read)
+  assert.Equal(t, []string{"rob"}, req.Body("name"))
+  assert.Equal(t, 8, body.read)
+}
+
+func Test_compressed_bodies_are_decompressed_within_the_limit(t *testing.T) {
+  var compressed bytes.Buffer
+  writer := gzip.NewWriter(&compressed)
+  io.WriteString(writer, `{"name":"rob"}`)
+  writer.Close()
+
+  raw := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+  raw.Header.Set("Content-Type", "application/json")
+  raw.Header.Set("Content-Encoding", "gzip")
+  req := newRequest(raw, Express().(*express), newLocals())
+  var target struct {
+    Name string `json:"name"`
+  }
+  assert.NoError(t, req.Decode(&target))
+  assert.Equal(t, "rob", target.Name)
+
+  raw = httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+  raw.Header.Set("Content-Type", "application/json")
+  raw.Header.Set("Content-Encoding", "gzip")
+  req = newRequest(raw, Express().(*express), newLocals())
+  req.SetLimits(Limits{MaxDecompressedSize: 4})
+  assert.Equal(t, 413, toHTTPError(req.Decode(&target)).Status)
+
+  raw.Header.Set("Content-Encoding", "compress")
+  req = newRequest(raw, Express().(*express), newLocals())
+  assert.Equal(t, 415, toHTTPError(req.ParseBody()).Status)
+}
+
+func Test_Body_answers_a_decompressed_body_over_the_limit(t *testing.T) {
+  var compressed bytes.Buffer
+  writer := gzip.NewWriter(&compressed)
+  io.WriteString(writer, "name="+strings.Repeat("a", 64))
+  writer.Close()
+
+  app := Express()
+  app.Post("/form", WithLimits(Limits{MaxDecompressedSize: 16}))
+  app.Post("/form", func(req Request, res Response) {
+    res.Write("name=" + strings.Join(req.Body("name"), ","))
+  })
+  server := httptest.NewServer(app)
+  defer server.Close()
+  request, _ := http.NewRequest("POST", server.URL+"/form", bytes.NewReader(compressed.Bytes()))
+  request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  request.Header.Set("Content-Encoding", "gzip")
+  response, err := server.Client().Do(request)
+  if assert.NoError(t, err) {
+    content, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    assert.Equal(t, 413, response.StatusCode)
+    assert.NotContains(t, string(content), "name=")
+  }
+}
+
+func Test_brotli_bodies_are_decompressed(t *testing.T) {
+  var compressed bytes.Buffer
+  writer := brotli.NewWriter(&compressed)
+  io.WriteString(writer, `{"name":"rob"}`)
+  writer.Close()
+
+  raw := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+  raw.Header.Set("Content-Type", "application/json")
+  raw.Header.Set("Content-Encoding", "br")
+  req := newRequest(raw, Express().(*express), newLocals())
+  var target struct {
+    Name string `json:"name"`
+  }
+  assert.NoError(t, req.Decode(&target))
+  assert.Equal(t, "rob", target.Name)
+}
+
+func Test_Limits_keep_the_defaults_of_the_zero_fields(t *testing.T) {
+  app := Express().(*express)
+  app.Limits(Limits{MaxBodySize: 1 << 20, MaxFiles: Unlimited})
+  assert.Equal(t, int64(1<<20), app.limits.MaxBodySize)
+  assert.Equal(t, DefaultLimits.MaxDecompressedSize, app.limits.MaxDecompressedSize)
+  assert.Equal(t, DefaultLimits.MaxFields, app.limits.MaxFields)
+  assert.Equal(t, DefaultLimits.MaxDepth, app.limits.MaxDepth)
+  assert.Equal(t, Unlimited, app.limits.MaxFiles)
+
+  req := newRequest(httptest.NewRequest("POST", "/", nil), app, newLocals())
+  assert.NoError(t, req.SetLimits(Limits{MaxDecompressedSize: Unlimited}))
+  assert.Equal(t, int64(1<<20), req.limits.MaxBodySize)
+  assert.Equal(t, int64(Unlimited), req.limits.MaxDecompressedSize)
+  assert.Equal(t, DefaultLimits.MaxParams, req.limits.MaxParams)
+}
+
+func Test_RawBody_is_kept_along_with_the_parsed_body(t *testing.T) {
+  raw := httptest.NewRequest("POST", "/hook", strings.NewReader(`{"name":"rob"}`))
+  raw.Header.Set("Content-Type", "application/json")
+  req := newRequest(raw, Express().(*express), newLocals())
+  body, err := req.RawBody()
+  assert.NoError(t, err)
+  var target struct {
+    Name string `json:"name"`
+  }
+  assert.NoError(t, req.Bind(&target))
+  assert.Equal(t, "rob", target.Name)
+  again, _ := req.RawBody()
+  assert.Equal(t, `{"name":"rob"}`, string(body))
+  assert.Equal(t, body, again)
+
+  raw = httptest.NewRequest("POST", "/hook", strings.NewReader(`{"name":"rob"}`))
+  req = newRequest(raw, Express().(*express), newLocals())
+  req.ParseBody()
+  _, err = req.RawBody()
+  assert.Equal(t, ErrBodyConsumed, err)
+}
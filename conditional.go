@@ -0,0 +1,170 @@
+// Package goexpress conditional evaluates the conditional request
+// headers against the ETag and Last-Modified headers of the response
+//
+// A GET or HEAD response carrying an ETag or a Last-Modified header is
+// answered with a 304 Not Modified when the client copy is fresh.
+// The 412 Precondition Failed of the unsafe methods is opt-in, only the
+// handler knows the current ETag of the resource and the check has to
+// happen before the change, so a handler calls CheckPreconditions
+//
+//   app.Put("/docs/:id", func(req Request, res Response) {
+//     doc := load(req.Params().Get("id"))
+//     res.Header().Set("ETag", doc.ETag)
+//     if !res.CheckPreconditions() {
+//       // answered with a 412 Precondition Failed
+//       return
+//     }
+//     save(doc)
+//   })
+//
+// or a route runs the Preconditions middleware ahead of its handler
+//
+//   app.Put("/docs/:id", Preconditions(func(req Request) (string, time.Time) {
+//     return store.ETag(req.Params().Get("id")), time.Time{}
+//   }))
+//   app.Put("/docs/:id", saveDoc)
+package goexpress
+
+import (
+  "net/http"
+  "strings"
+  "time"
+)
+
+// etagMatches tells if the etag is in the list of an If-Match or an
+// If-None-Match header, the weak comparison ignores the W/ prefixes
+func etagMatches(list string, etag string, weak bool) bool {
+  for _, item := range strings.Split(list, ",") {
+    item = strings.TrimSpace(item)
+    switch {
+    case item == "*":
+      return true
+    case etag == "":
+      continue
+    case weak && strings.TrimPrefix(item, "W/") == strings.TrimPrefix(etag, "W/"):
+      return true
+    case !weak && item == etag && !strings.HasPrefix(etag, "W/"):
+      return true
+    }
+  }
+  return false
+}
+
+// parseHTTPDate parses a date header, ok is false if it is absent or invalid
+func parseHTTPDate(value string) (date time.Time, ok bool) {
+  if value == "" {
+    return date, false
+  }
+  date, err := http.ParseTime(value)
+  return date, err == nil
+}
+
+// modifiedSince tells if the Last-Modified of the response is after the date
+func (res *response) modifiedSince(value string) (modified bool, ok bool) {
+  since, ok := parseHTTPDate(value)
+  if !ok {
+    return false, false
+  }
+  lastModified, ok := parseHTTPDate(res.header.Get("Last-Modified"))
+  if !ok {
+    return false, false
+  }
+  return lastModified.After(since), true
+}
+
+// isSafeMethod tells if the method only reads
+func isSafeMethod(method string) bool {
+  return method == "GET" || method == "HEAD"
+}
+
+// Fresh tells if the client copy of a GET or HEAD response is still
+// valid as per If-None-Match or If-Modified-Since, so a 304 Not
+// Modified can be sent instead of the body
+func (req *request) Fresh() bool {
+  res := req.response
+  if res == nil || !isSafeMethod(req.ref.Method) {
+    return false
+  }
+  if status := res.header.StatusCode; status != 0 && status != 304 && (status < 200 || status >= 300) {
+    return false
+  }
+  if strings.Contains(req.ref.Header.Get("Cache-Control"), "no-cache") {
+    return false
+  }
+  if noneMatch := req.header.Get("If-None-Match"); noneMatch != "" {
+    // If-Modified-Since is ignored along with If-None-Match
+    return etagMatches(noneMatch, res.header.Get("ETag"), true)
+  }
+  modified, ok := res.modifiedSince(req.ref.Header.Get("If-Modified-Since"))
+  return ok && !modified
+}
+
+// Stale is the opposite of Fresh
+func (req *request) Stale() bool {
+  return !req.Fresh()
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since against the ETag and the
+// Last-Modified headers set on the response, it answers with a 304 Not
+// Modified for the fresh GET and HEAD requests, with a 412 Precondition
+// Failed for a failed precondition and returns false if it did so
+// It is not called on its own, the unsafe methods opt in by calling it
+// or with the Preconditions middleware
+func (res *response) CheckPreconditions() bool {
+  var request = res.header.request
+  var etag = res.header.Get("ETag")
+  var exists = etag != "" || res.header.Get("Last-Modified") != ""
+  if match := request.Header.Get("If-Match"); match != "" {
+    if !exists || !etagMatches(match, etag, false) {
+      res.Fail(NewHTTPError(412, ""))
+      return false
+    }
+  } else if modified, ok := res.modifiedSince(request.Header.Get("If-Unmodified-Since")); ok && modified {
+    res.Fail(NewHTTPError(412, ""))
+    return false
+  }
+  if noneMatch := request.Header.Get("If-None-Match"); noneMatch != "" {
+    if exists && etagMatches(noneMatch, etag, true) {
+      if isSafeMethod(request.Method) {
+        res.sendNotModified()
+      } else {
+        res.Fail(NewHTTPError(412, ""))
+      }
+      return false
+    }
+  } else if modified, ok := res.modifiedSince(request.Header.Get("If-Modified-Since")); ok && !modified && isSafeMethod(request.Method) {
+    res.sendNotModified()
+    return false
+  }
+  return true
+}
+
+// Preconditions returns a middleware evaluating the conditional headers
+// against the current ETag and Last-Modified of the resource given by
+// the validators callback, the zero values are left out, a request
+// whose preconditions fail is answered with a 412, or a 304 for GET and
+// HEAD, before the next handlers run, see CheckPreconditions
+func Preconditions(validators func(req Request) (etag string, lastModified time.Time)) Middleware {
+  return func(req Request, res Response) {
+    etag, lastModified := validators(req)
+    if etag != "" {
+      res.Header().Set("ETag", etag)
+    }
+    if !lastModified.IsZero() {
+      res.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+    }
+    res.CheckPreconditions()
+  }
+}
+
+// sendNotModified answers with a 304 Not Modified without a body
+func (res *response) sendNotModified() {
+  if res.header.BasicSent() {
+    res.End()
+    return
+  }
+  res.header.SetStatus(304)
+  res.header.Del("Content-Type")
+  res.End()
+}
@@ -0,0 +1,78 @@
+package goexpress
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_conditional_requests(t *testing.T) {
+  app := Express()
+  app.Get("/doc", func(req Request, res Response) {
+    res.Header().Set("ETag", `"v2"`)
+    res.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+    res.JSON(map[string]string{"version": "2"})
+  })
+  app.Put("/doc", func(req Request, res Response) {
+    res.Header().Set("ETag", `"v2"`)
+    if res.CheckPreconditions() {
+      res.Write("saved")
+    }
+  })
+
+  response, body := get(t, app, "/doc", map[string]string{"If-None-Match": `W/"v1", "v2"`})
+  assert.Equal(t, 304, response.StatusCode)
+  assert.Empty(t, body)
+  response, _ = get(t, app, "/doc", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"})
+  assert.Equal(t, 304, response.StatusCode)
+  response, body = get(t, app, "/doc", map[string]string{"If-None-Match": `"v1"`})
+  assert.Equal(t, 200, response.StatusCode)
+  assert.JSONEq(t, `{"version":"2"}`, body)
+
+  server := httptest.NewServer(app)
+  defer server.Close()
+  for match, status := range map[string]int{`"v1"`: 412, `"v2"`: 200} {
+    request, _ := http.NewRequest("PUT", server.URL+"/doc", strings.NewReader(""))
+    request.Header.Set("If-Match", match)
+    response, err := server.Client().Do(request)
+    if assert.NoError(t, err) {
+      response.Body.Close()
+      assert.Equal(t, status, response.StatusCode, match)
+    }
+  }
+}
+
+func Test_Preconditions_answers_before_the_handler(t *testing.T) {
+  app := Express()
+  var deleted = 0
+  app.Delete("/doc", Preconditions(func(req Request) (string, time.Time) {
+    return `"v2"`, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+  }))
+  app.Delete("/doc", func(req Request, res Response) {
+    deleted++
+    res.SendStatus(204)
+  })
+  server := httptest.NewServer(app)
+  defer server.Close()
+  for _, test := range []struct {
+    header, value string
+    status        int
+  }{
+    {"If-Match", `"v1"`, 412},
+    {"If-Unmodified-Since", "Sun, 01 Jan 2006 00:00:00 GMT", 412},
+    {"If-Match", `"v2"`, 204},
+  } {
+    request, _ := http.NewRequest("DELETE", server.URL+"/doc", nil)
+    request.Header.Set(test.header, test.value)
+    response, err := server.Client().Do(request)
+    if assert.NoError(t, err) {
+      response.Body.Close()
+      assert.Equal(t, test.status, response.StatusCode, test.value)
+    }
+  }
+  assert.Equal(t, 1, deleted)
+}
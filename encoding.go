@@ -0,0 +1,107 @@
+// Package goexpress encoding decompresses the request bodies sent with
+// a Content-Encoding header before they are parsed
+//
+// gzip, deflate and brotli are built-in, other encodings are plugged in
+// by registering a decoder, i.e. for zstd
+//
+//   RegisterContentDecoder("zstd", func(body io.Reader) (io.Reader, error) {
+//     return zstd.NewReader(body)
+//   })
+//
+// The decompressed body is bounded by the MaxDecompressedSize limit so
+// a small compressed body can not expand into an unbounded one.
+package goexpress
+
+import (
+  "bufio"
+  "compress/flate"
+  "compress/gzip"
+  "compress/zlib"
+  "io"
+  "strings"
+  "sync"
+
+  "github.com/andybalholm/brotli"
+)
+
+// ContentDecoder returns a reader decompressing the body
+type ContentDecoder func(body io.Reader) (io.Reader, error)
+
+var (
+  contentDecoderMutex sync.RWMutex
+  contentDecoders     = map[string]ContentDecoder{
+    "gzip":    newGzipReader,
+    "x-gzip":  newGzipReader,
+    "deflate": newDeflateReader,
+    "br":      newBrotliReader,
+  }
+)
+
+// RegisterContentDecoder adds a decoder for a Content-Encoding
+func RegisterContentDecoder(encoding string, decoder ContentDecoder) {
+  contentDecoderMutex.Lock()
+  contentDecoders[strings.ToLower(encoding)] = decoder
+  contentDecoderMutex.Unlock()
+}
+
+func newGzipReader(body io.Reader) (io.Reader, error) {
+  return gzip.NewReader(body)
+}
+
+func newBrotliReader(body io.Reader) (io.Reader, error) {
+  return brotli.NewReader(body), nil
+}
+
+// newDeflateReader reads the zlib wrapped deflate bodies and the raw
+// deflate ones sent by some clients
+func newDeflateReader(body io.Reader) (io.Reader, error) {
+  buffered := bufio.NewReader(body)
+  head, err := buffered.Peek(2)
+  if err != nil && err != io.EOF {
+    return nil, err
+  }
+  // a zlib header has the deflate method and is a multiple of 31
+  if len(head) == 2 && head[0]&0x0F == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+    return zlib.NewReader(buffered)
+  }
+  return flate.NewReader(buffered), nil
+}
+
+// decodeContent wraps the body with the decoders of the Content-Encoding
+// header, the encodings are undone in the reverse order they were applied
+func (req *request) decodeContent() error {
+  var encodings = splitHeaderList(req.ref.Header.Values("Content-Encoding"))
+  if len(encodings) == 0 {
+    return nil
+  }
+  var httRequest = req.ref
+  var body io.Reader = httRequest.Body
+  var decoded = false
+  for i := len(encodings) - 1; i >= 0; i-- {
+    encoding := strings.ToLower(encodings[i])
+    if encoding == "identity" {
+      continue
+    }
+    contentDecoderMutex.RLock()
+    decoder, found := contentDecoders[encoding]
+    contentDecoderMutex.RUnlock()
+    if !found {
+      return NewHTTPError(415, "Unsupported content encoding "+encoding)
+    }
+    reader, err := decoder(body)
+    if err != nil {
+      return bodyError(err, "Invalid "+encoding+" body")
+    }
+    body, decoded = reader, true
+  }
+  if !decoded {
+    return nil
+  }
+  if max := req.limits.MaxDecompressedSize; max > 0 {
+    body = newLimitedReader(body, max, NewHTTPError(413, "Decompressed request body is too large"))
+  }
+  httRequest.Body = &wrappedBody{Reader: body, Closer: httRequest.Body}
+  httRequest.ContentLength = -1
+  httRequest.Header.Del("Content-Length")
+  return nil
+}
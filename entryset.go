@@ -0,0 +1,162 @@
+// Package goexpress entryset holds the route params and the typed
+// conversions shared with the request headers
+//
+//   page, err := req.Params().Int("page")
+//   if errors.Is(err, ErrEntryNotFound) {
+//     page = 1
+//   }
+package goexpress
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "sort"
+  "strconv"
+  "time"
+)
+
+// ErrEntryNotFound is returned by the typed getters for a missing key
+var ErrEntryNotFound = errors.New("goexpress: entry not found")
+
+// EntrySet defines a map entry set
+type EntrySet struct {
+  keys map[string]string
+}
+
+// newEntrySet returns an empty entry set
+func newEntrySet() *EntrySet {
+  return &EntrySet{keys: make(map[string]string)}
+}
+
+// Get returns a value from the entry set
+func (e *EntrySet) Get(key string) string {
+  return e.keys[key]
+}
+
+// Set a value to the entry set
+func (e *EntrySet) Set(key string, v string) {
+  e.keys[key] = v
+}
+
+// Has tells if the key is set, even to an empty value
+func (e *EntrySet) Has(key string) bool {
+  _, found := e.keys[key]
+  return found
+}
+
+// Del removes a key
+func (e *EntrySet) Del(key string) {
+  delete(e.keys, key)
+}
+
+// Keys returns the keys in sorted order
+func (e *EntrySet) Keys() []string {
+  var keys = make([]string, 0, len(e.keys))
+  for key := range e.keys {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// Len returns the number of the keys
+func (e *EntrySet) Len() int {
+  return len(e.keys)
+}
+
+// Range calls the callback with every entry in sorted order until it
+// returns false
+func (e *EntrySet) Range(callback func(key string, value string) bool) {
+  for _, key := range e.Keys() {
+    if !callback(key, e.keys[key]) {
+      return
+    }
+  }
+}
+
+// GetOr returns the value of a key or the fallback if it is not set
+func (e *EntrySet) GetOr(key string, fallback string) string {
+  if value, found := e.keys[key]; found {
+    return value
+  }
+  return fallback
+}
+
+// Int returns the value of a key as int
+func (e *EntrySet) Int(key string) (int, error) {
+  value, found := e.keys[key]
+  return entryInt(key, value, found)
+}
+
+// Bool returns the value of a key as bool, see strconv.ParseBool
+func (e *EntrySet) Bool(key string) (bool, error) {
+  value, found := e.keys[key]
+  return entryBool(key, value, found)
+}
+
+// Float returns the value of a key as float64
+func (e *EntrySet) Float(key string) (float64, error) {
+  value, found := e.keys[key]
+  return entryFloat(key, value, found)
+}
+
+// Duration returns the value of a key as time.Duration, i.e. "1m30s"
+func (e *EntrySet) Duration(key string) (time.Duration, error) {
+  value, found := e.keys[key]
+  return entryDuration(key, value, found)
+}
+
+// MarshalJSON encodes the entries as a JSON object
+func (e *EntrySet) MarshalJSON() ([]byte, error) {
+  return json.Marshal(e.keys)
+}
+
+// entryError describes a value which could not be converted
+func entryError(key string, value string, err error) error {
+  return fmt.Errorf("goexpress: invalid value %q of %s: %w", value, key, err)
+}
+
+func entryInt(key string, value string, found bool) (int, error) {
+  if !found {
+    return 0, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+  }
+  i, err := strconv.Atoi(value)
+  if err != nil {
+    return 0, entryError(key, value, err)
+  }
+  return i, nil
+}
+
+func entryBool(key string, value string, found bool) (bool, error) {
+  if !found {
+    return false, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+  }
+  b, err := strconv.ParseBool(value)
+  if err != nil {
+    return false, entryError(key, value, err)
+  }
+  return b, nil
+}
+
+func entryFloat(key string, value string, found bool) (float64, error) {
+  if !found {
+    return 0, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+  }
+  f, err := strconv.ParseFloat(value, 64)
+  if err != nil {
+    return 0, entryError(key, value, err)
+  }
+  return f, nil
+}
+
+func entryDuration(key string, value string, found bool) (time.Duration, error) {
+  if !found {
+    return 0, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+  }
+  d, err := time.ParseDuration(value)
+  if err != nil {
+    return 0, entryError(key, value, err)
+  }
+  return d, nil
+}
@@ -0,0 +1,90 @@
+package goexpress
+
+import (
+  "encoding/json"
+  "strconv"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_EntrySet_typed_getters(t *testing.T) {
+  params := newEntrySet()
+  params.Set("page", "2")
+  params.Set("ratio", "0.5")
+  params.Set("draft", "yes")
+  params.Set("empty", "")
+
+  page, err := params.Int("page")
+  assert.NoError(t, err)
+  assert.Equal(t, 2, page)
+  ratio, _ := params.Float("ratio")
+  assert.Equal(t, 0.5, ratio)
+  _, err = params.Bool("draft")
+  assert.Error(t, err)
+  _, err = params.Duration("timeout")
+  assert.ErrorIs(t, err, ErrEntryNotFound)
+  assert.True(t, params.Has("empty"))
+  assert.Equal(t, "10s", params.GetOr("timeout", "10s"))
+  params.Del("draft")
+  assert.Equal(t, []string{"empty", "page", "ratio"}, params.Keys())
+  assert.Equal(t, 3, params.Len())
+
+  output, err := json.Marshal(params)
+  assert.NoError(t, err)
+  assert.JSONEq(t, `{"empty":"","page":"2","ratio":"0.5"}`, string(output))
+}
+
+func Test_EntrySet_typed_getters_report_parse_failures(t *testing.T) {
+  params := newEntrySet()
+  params.Set("page", "two")
+  params.Set("timeout", "soon")
+
+  page, err := params.Int("page")
+  assert.Equal(t, 0, page)
+  assert.ErrorIs(t, err, strconv.ErrSyntax)
+  assert.NotErrorIs(t, err, ErrEntryNotFound)
+  assert.EqualError(t, err, `goexpress: invalid value "two" of page: strconv.Atoi: parsing "two": invalid syntax`)
+
+  timeout, err := params.Duration("timeout")
+  assert.Equal(t, time.Duration(0), timeout)
+  assert.NotErrorIs(t, err, ErrEntryNotFound)
+  assert.EqualError(t, err, `goexpress: invalid value "soon" of timeout: time: invalid duration "soon"`)
+
+  _, err = params.Int("missing")
+  assert.ErrorIs(t, err, ErrEntryNotFound)
+  assert.EqualError(t, err, "goexpress: entry not found: missing")
+}
+
+func Test_EntrySet_Del_GetOr_and_Range(t *testing.T) {
+  params := newEntrySet()
+  params.Set("b", "2")
+  params.Set("a", "1")
+  params.Set("c", "")
+
+  // an empty value is set, the fallback is only for the missing keys
+  assert.Equal(t, "", params.GetOr("c", "fallback"))
+  assert.Equal(t, "fallback", params.GetOr("d", "fallback"))
+
+  var visited []string
+  params.Range(func(key string, value string) bool {
+    visited = append(visited, key+"="+value)
+    return true
+  })
+  assert.Equal(t, []string{"a=1", "b=2", "c="}, visited)
+
+  visited = nil
+  params.Range(func(key string, value string) bool {
+    visited = append(visited, key)
+    return key != "b"
+  })
+  assert.Equal(t, []string{"a", "b"}, visited)
+
+  params.Del("a")
+  params.Del("missing")
+  assert.False(t, params.Has("a"))
+  assert.Equal(t, "", params.Get("a"))
+  assert.Equal(t, []string{"b", "c"}, params.Keys())
+  assert.Equal(t, 2, params.Len())
+}
@@ -0,0 +1,177 @@
+// Package goexpress errors handles the requests which could not be
+// served, either because no route matched, a handler panicked or
+// failed with an error passed to Response.Fail
+//
+// app.NotFound() and app.OnError() hooks take over the default pages
+// which are sent as HTML or JSON depending on the request Accept header.
+// Only when the env is set to "development" the default error page
+// carries the panic value and the stack trace, never by default.
+package goexpress
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "html/template"
+  "log"
+  "runtime/debug"
+)
+
+// ErrorHandler handles an error raised while serving a request,
+// the next error handler is called if the response is not ended
+type ErrorHandler func(err error, request Request, response Response)
+
+// PanicError is the error passed to the error handlers when a handler panics
+type PanicError struct {
+  Value interface{}
+  Stack []byte
+}
+
+// newPanicError wraps a recovered value along with the current stack
+func newPanicError(value interface{}) *PanicError {
+  return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// Error returns the panic value as string
+func (p *PanicError) Error() string {
+  return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the panic value if it was an error
+func (p *PanicError) Unwrap() error {
+  err, _ := p.Value.(error)
+  return err
+}
+
+// errorBody is the default error response body
+type errorBody struct {
+  Status    int                    `json:"status"`
+  Message   string                 `json:"message"`
+  Details   map[string]interface{} `json:"details,omitempty"`
+  RequestID string                 `json:"request_id,omitempty"`
+  Error     string                 `json:"error,omitempty"`
+  Stack     string                 `json:"stack,omitempty"`
+}
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}} {{.Message}}</title></head>
+<body>
+<h1>{{.Status}} {{.Message}}</h1>
+{{if .Details}}<dl>{{range $key, $value := .Details}}<dt>{{$key}}</dt><dd>{{$value}}</dd>{{end}}</dl>{{end}}
+{{if .RequestID}}<p>Request ID: <code>{{.RequestID}}</code></p>{{end}}
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Stack}}<pre>{{.Stack}}</pre>{{end}}
+</body>
+</html>
+`))
+
+// sendErrorPage sends the default error page for the error, the
+// internal cause is only exposed in the "development" env
+func (res *response) sendErrorPage(httpErr *HTTPError) {
+  if res.header.BasicSent() {
+    // the status line is already out, nothing else to do
+    res.End()
+    return
+  }
+  res.header.SetStatus(httpErr.Status)
+  var body = &errorBody{Status: httpErr.Status, Message: httpErr.Message, Details: httpErr.Details}
+  if res.request != nil {
+    body.RequestID = res.request.id
+  }
+  if httpErr.Cause != nil && res.settings.String(SettingEnv) == "development" {
+    body.Error = httpErr.Cause.Error()
+    var panicErr *PanicError
+    if errors.As(httpErr.Cause, &panicErr) {
+      body.Stack = string(panicErr.Stack)
+    }
+  }
+  if negotiateMediaType(res.requestHeader("Accept"), "text/html", "application/json") == "application/json" {
+    output, _ := json.Marshal(map[string]*errorBody{"error": body})
+    res.sendContent(httpErr.Status, "application/json", output)
+    return
+  }
+  var page bytes.Buffer
+  errorTemplate.Execute(&page, body)
+  res.sendContent(httpErr.Status, "text/html;charset=utf-8", page.Bytes())
+}
+
+// requestHeader returns a header of the request being answered
+func (res *response) requestHeader(key string) string {
+  return res.header.request.Header.Get(key)
+}
+
+// NotFound sets the handler called when no route matches the request,
+// the response status is 404 unless the handler changes it
+func (e *express) NotFound(handler Middleware) ExpressInterface {
+  e.notFound = handler
+  return e
+}
+
+// OnError adds a handler called when a handler fails, the handlers are
+// called in the order they were added until one of them ends the response
+func (e *express) OnError(handler ErrorHandler) ExpressInterface {
+  e.errorHandlers = append(e.errorHandlers, handler)
+  return e
+}
+
+// handleNotFound answers a request no route matched, the NotFound
+// handler starts with a 404 status
+func (e *express) handleNotFound(req *request, res *response) {
+  if e.notFound != nil {
+    res.header.SetStatus(404)
+    e.notFound(req, res)
+    if res.HasEnded() == false {
+      res.End()
+    }
+    return
+  }
+  res.sendErrorPage(NewHTTPError(404, ""))
+}
+
+// handleError logs the error, passes it down the error handlers and
+// falls back to the default error page
+func (e *express) handleError(err error, req *request, res *response) {
+  var httpErr = toHTTPError(err)
+  logHTTPError(req, httpErr)
+  if res.HasEnded() {
+    return
+  }
+  for _, handler := range e.errorHandlers {
+    if e.callErrorHandler(handler, err, req, res) == false || res.HasEnded() {
+      break
+    }
+  }
+  if res.HasEnded() == false {
+    res.sendErrorPage(httpErr)
+  }
+}
+
+// logHTTPError logs an error with a level as per its status class,
+// the stack is logged for the panics
+func logHTTPError(req *request, httpErr *HTTPError) {
+  var level = "INFO"
+  if httpErr.Status >= 500 {
+    level = "ERROR"
+  } else if httpErr.Status >= 400 {
+    level = "WARN"
+  }
+  log.Printf("[%s] [%s] %s %s: %v", level, req.id, req.ref.Method, req.url, httpErr)
+  var panicErr *PanicError
+  if errors.As(httpErr, &panicErr) {
+    log.Printf("[%s] [%s] %s", level, req.id, panicErr.Stack)
+  }
+}
+
+// callErrorHandler calls an error handler, returns false if it panicked
+func (e *express) callErrorHandler(handler ErrorHandler, err error, req *request, res *response) (ok bool) {
+  defer func() {
+    if recovered := recover(); recovered != nil {
+      log.Printf("[%s] Error handler panicked: %v", req.id, recovered)
+      ok = false
+    }
+  }()
+  handler(err, req, res)
+  return true
+}
@@ -8,6 +8,9 @@
 // app.Use(), app.Get(), app.Post(), app.Delete(), app.Push()
 // app.Put() are the top level functions that can be used in
 // the same fashion as the express-js ones are.
+//
+// The app itself is a http.Handler and can be mounted on any
+// net/http server, mux or httptest.NewServer.
 package goexpress
 
 import (
@@ -17,23 +20,31 @@ import (
   http "net/http"
   "os"
   "os/signal"
+  "sync/atomic"
   "time"
 )
 
 type express struct {
-  router       *router
-  server       *http.Server
-  started      bool
-  drainTimeout time.Duration
-  drainMethod  func(ExpressInterface)
-  properties   map[string]interface{}
+  router        *router
+  server        *http.Server
+  started       bool
+  drainTimeout  time.Duration
+  drainMethod   func(ExpressInterface)
+  settings      *Settings
+  parsers       *bodyParsers
+  limits        Limits
+  notFound      Middleware
+  errorHandlers []ErrorHandler
+  proxies       atomic.Value // *proxyCache of the "trust proxy" setting
 }
 
 // Express returns a new instance of express
 func Express() ExpressInterface {
   var exp = &express{}
   exp.router = newRouter()
-  exp.properties = make(map[string]interface{})
+  exp.settings = newSettings()
+  exp.parsers = newBodyParsers()
+  exp.limits = DefaultLimits
   return exp
 }
 
@@ -48,17 +59,27 @@ func (e *express) ServeHTTP(res http.ResponseWriter, req *http.Request) {
       http.Error(res, err.Error(), http.StatusInternalServerError)
       return
     }
-    var response = newResponse(res, req, bufrw, conn, &e.properties)
-    var request = newRequest(req, &e.properties)
+    var locals = newLocals()
+    var response = newResponse(res, req, bufrw, conn, e.settings, locals)
+    var request = newRequest(req, e, locals)
+    response.request = request
+    request.response = response
+    if name := e.settings.String(SettingRequestIDHeader); name != "" {
+      response.header.Set(name, request.id)
+    }
+    var options = e.routeOptions()
+    response.fail = func(err error) {
+      e.handleError(err, request, response)
+    }
     var index = 0
     var executedRoutes = 0
     var _next NextFunc
+    // the uploads spilled to the disk do not outlive the request
+    defer request.removeTempFiles()
     // doctor the request in case of any error
     defer func() {
       if err := recover(); err != nil {
-        if !response.HasEnded() {
-          response.Error(500, "Internal server error")
-        }
+        e.handleError(newPanicError(err), request, response)
       }
     }()
 
@@ -67,14 +88,12 @@ func (e *express) ServeHTTP(res http.ResponseWriter, req *http.Request) {
         // we are done
         return
       }
-      var handler, i, isMiddleware = e.router.FindNext(index, request.method, request.url, request)
+      var handler, i, isMiddleware = e.router.FindNext(index, request.method, request.url, request, options)
       if i == -1 {
         // done handling
         if executedRoutes == 0 {
           // 404
-          response.header.SetStatus(404)
-          response.Write("Not Found")
-          response.End()
+          e.handleNotFound(request, response)
           return
         }
         // should close connection
@@ -88,8 +107,14 @@ func (e *express) ServeHTTP(res http.ResponseWriter, req *http.Request) {
           executedRoutes++
         }
         index = i + 1
+        // adapted net/http middlewares continue the chain from within
+        var continued = false
+        request.next = func() {
+          continued = true
+          n(n)
+        }
         handler(request, response)
-        if response.HasEnded() == false {
+        if continued == false && response.HasEnded() == false {
           n(n)
         }
       }
@@ -146,15 +171,59 @@ func NewRouter() Router {
   return route
 }
 
-// Sets global app properties that can be accessed under express struct
-func (e *express) SetProp(key string, value interface{}) ExpressInterface {
-  e.properties[key] = value
+// Set sets an app setting, see the Setting* constants for the well known keys
+func (e *express) Set(key string, value interface{}) ExpressInterface {
+  e.settings.Set(key, value)
+  return e
+}
+
+// Enable sets a boolean app setting to true
+func (e *express) Enable(key string) ExpressInterface {
+  e.settings.Enable(key)
+  return e
+}
+
+// Disable sets a boolean app setting to false
+func (e *express) Disable(key string) ExpressInterface {
+  e.settings.Disable(key)
+  return e
+}
+
+// Enabled tells whether a boolean app setting is true
+func (e *express) Enabled(key string) bool {
+  return e.settings.Enabled(key)
+}
+
+// Settings returns the app settings registry
+func (e *express) Settings() *Settings {
+  return e.settings
+}
+
+// BodyParser registers a parser for the request bodies of a media type,
+// the parser is used by Request.Decode and Request.Bind
+func (e *express) BodyParser(mediaType string, parser BodyParser) ExpressInterface {
+  e.parsers.set(mediaType, parser)
   return e
 }
 
-// Return the app property
+// SetProp sets an app setting
+// Deprecated: use Set instead
+func (e *express) SetProp(key string, value interface{}) ExpressInterface {
+  return e.Set(key, value)
+}
+
+// GetProp returns an app setting, the second argument is ignored
+// Deprecated: use Settings().Get instead
 func (e *express) GetProp(key string, value interface{}) interface{} {
-  return e.properties[key]
+  return e.settings.Get(key)
+}
+
+// routeOptions returns the route matching flags from the settings
+func (e *express) routeOptions() routeOptions {
+  return routeOptions{
+    caseSensitive: e.settings.Bool(SettingCaseSensitiveRouting),
+    strict:        e.settings.Bool(SettingStrictRouting),
+  }
 }
 
 // Starts the App Server
@@ -0,0 +1,373 @@
+package goexpress
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "fmt"
+  "io"
+  "log"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+type contextKey string
+
+// get performs a GET request against the app and returns the response with its body
+func get(t *testing.T, app ExpressInterface, path string, headers map[string]string) (*http.Response, string) {
+  server := httptest.NewServer(app)
+  defer server.Close()
+  request, err := http.NewRequest("GET", server.URL+path, nil)
+  assert.NoError(t, err)
+  for key, value := range headers {
+    request.Header.Set(key, value)
+  }
+  response, err := server.Client().Do(request)
+  if !assert.NoError(t, err) {
+    t.FailNow()
+  }
+  defer response.Body.Close()
+  body, err := io.ReadAll(response.Body)
+  assert.NoError(t, err)
+  return response, string(body)
+}
+
+func Test_Express_serves_through_httptest(t *testing.T) {
+  app := Express()
+  app.Get("/hello/:name", func(req Request, res Response) {
+    res.Header().Set("X-Name", req.Params().Get("name"))
+    res.Write("Hello " + req.Params().Get("name"))
+  })
+  response, body := get(t, app, "/hello/rob", nil)
+  assert.Equal(t, 200, response.StatusCode)
+  assert.Equal(t, "rob", response.Header.Get("X-Name"))
+  assert.Equal(t, "Hello rob", body)
+
+  response, _ = get(t, app, "/missing", nil)
+  assert.Equal(t, 404, response.StatusCode)
+}
+
+func Test_Express_mounts_net_http_handlers_and_middlewares(t *testing.T) {
+  app := Express()
+  app.Use(func(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      w.Header().Set("X-Middleware", "1")
+      next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey("user"), "rob")))
+    })
+  })
+  app.Get("/context", func(req Request, res Response) {
+    res.Write(req.GetRaw().Context().Value(contextKey("user")).(string))
+  })
+  app.Get("/std", HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(201)
+    io.WriteString(w, "net/http")
+  }))
+
+  response, body := get(t, app, "/context", nil)
+  assert.Equal(t, "1", response.Header.Get("X-Middleware"))
+  assert.Equal(t, "rob", body)
+
+  response, body = get(t, app, "/std", nil)
+  assert.Equal(t, 201, response.StatusCode)
+  assert.Equal(t, "net/http", body)
+}
+
+func Test_HTTPHandler_file_server_is_not_sent_with_a_length(t *testing.T) {
+  dir := t.TempDir()
+  assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0644))
+  app := Express()
+  app.Get("/static/(.*)", HTTPHandler(http.StripPrefix("/static/", http.FileServer(http.Dir(dir)))))
+  server := httptest.NewServer(app)
+  defer server.Close()
+  conn, err := net.Dial("tcp", server.Listener.Addr().String())
+  if !assert.NoError(t, err) {
+    t.FailNow()
+  }
+  defer conn.Close()
+  fmt.Fprintf(conn, "GET /static/hello.txt HTTP/1.1\r\nHost: test\r\n\r\n")
+  // read raw, http.ReadResponse drops the length of a chunked body
+  raw, _ := io.ReadAll(conn)
+  head, body, _ := strings.Cut(string(raw), "\r\n\r\n")
+  assert.Contains(t, strings.ToLower(head), "transfer-encoding: chunked")
+  assert.NotContains(t, strings.ToLower(head), "content-length")
+  assert.Equal(t, "5\r\nhello\r\n0\r\n\r\n", body)
+}
+
+func Test_Response_late_header_flushes_keep_the_sent_response(t *testing.T) {
+  app := Express()
+  app.Get("/redirect", func(req Request, res Response) {
+    res.Write("partial")
+    res.Redirect("/elsewhere")
+  })
+  app.Get("/render", func(req Request, res Response) {
+    res.Write("partial")
+    res.Render("missing.html", nil)
+  })
+  app.Get("/file", func(req Request, res Response) {
+    res.Write("partial")
+    res.SendFile("missing.txt", true)
+  })
+  for _, path := range []string{"/redirect", "/render", "/file"} {
+    response, body := get(t, app, path, nil)
+    assert.Equal(t, 200, response.StatusCode, path)
+    assert.Equal(t, "partial", body, path)
+  }
+}
+
+// lockedBuffer collects the log output written by the serving goroutines
+type lockedBuffer struct {
+  sync.Mutex
+  buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+  b.Lock()
+  defer b.Unlock()
+  return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+  b.Lock()
+  defer b.Unlock()
+  return b.buf.String()
+}
+
+func Test_Response_logs_carry_the_request_id(t *testing.T) {
+  var output lockedBuffer
+  log.SetOutput(&output)
+  defer log.SetOutput(os.Stderr)
+  app := Express()
+  app.Get("/render", func(req Request, res Response) {
+    res.Render("missing.html", nil)
+  })
+  get(t, app, "/render", map[string]string{"X-Request-ID": "req-7"})
+  assert.Contains(t, output.String(), "[req-7] Template not found")
+}
+
+func Test_Express_not_found_and_error_hooks(t *testing.T) {
+  app := Express()
+  app.Get("/panic", func(req Request, res Response) {
+    panic("boom")
+  })
+  // default pages are negotiated on the Accept header
+  response, body := get(t, app, "/missing", map[string]string{"Accept": "application/json", "X-Request-ID": "req-1"})
+  assert.Equal(t, 404, response.StatusCode)
+  assert.JSONEq(t, `{"error":{"status":404,"message":"Not Found","request_id":"req-1"}}`, body)
+
+  // the internal error stays out of the page unless in development
+  response, body = get(t, app, "/panic", nil)
+  assert.Equal(t, 500, response.StatusCode)
+  assert.Contains(t, response.Header.Get("Content-Type"), "text/html")
+  assert.NotContains(t, body, "boom")
+  assert.NotContains(t, body, "goroutine")
+  app.Set(SettingEnv, "development")
+  _, body = get(t, app, "/panic", nil)
+  assert.Contains(t, body, "panic: boom")
+  app.Set(SettingEnv, "production")
+
+  app.NotFound(func(req Request, res Response) {
+    res.Write("nothing here")
+  })
+  app.OnError(func(err error, req Request, res Response) {
+    res.Header().SetStatus(503)
+    res.Write(err.Error())
+    res.End()
+  })
+  response, body = get(t, app, "/missing", nil)
+  assert.Equal(t, 404, response.StatusCode)
+  assert.Equal(t, "nothing here", body)
+  response, body = get(t, app, "/panic", nil)
+  assert.Equal(t, 503, response.StatusCode)
+  assert.Equal(t, "panic: boom", body)
+}
+
+func Test_Express_renders_HTTPError_from_handlers(t *testing.T) {
+  app := Express()
+  app.Get("/user/:id", Handle(func(req Request, res Response) error {
+    return NewHTTPError(404, "user not found").WithDetail("id", req.Params().Get("id"))
+  }))
+  app.Get("/bad", func(req Request, res Response) {
+    res.Error(400, "Invalid input")
+  })
+  response, body := get(t, app, "/user/10", map[string]string{"Accept": "application/json", "X-Request-ID": "req-1"})
+  assert.Equal(t, 404, response.StatusCode)
+  assert.Equal(t, "req-1", response.Header.Get("X-Request-ID"))
+  assert.JSONEq(t, `{"error":{"status":404,"message":"user not found","details":{"id":"10"},"request_id":"req-1"}}`, body)
+
+  response, body = get(t, app, "/bad", map[string]string{"X-Request-ID": "bad id"})
+  assert.Equal(t, 400, response.StatusCode)
+  assert.Contains(t, body, "Invalid input")
+  assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, response.Header.Get("X-Request-ID"))
+  assert.Contains(t, body, response.Header.Get("X-Request-ID"))
+}
+
+func Test_Response_status_and_send_helpers(t *testing.T) {
+  app := Express()
+  app.Get("/created", func(req Request, res Response) {
+    res.Status(201).JSON(map[string]int{"id": 1})
+  })
+  app.Get("/text", func(req Request, res Response) {
+    res.Text("plain")
+  })
+  app.Get("/bytes", func(req Request, res Response) {
+    res.Send([]byte{1, 2})
+  })
+  app.Get("/empty", func(req Request, res Response) {
+    res.NoContent()
+  })
+  app.Get("/status", func(req Request, res Response) {
+    res.SendStatus(202)
+  })
+
+  response, body := get(t, app, "/created", nil)
+  assert.Equal(t, 201, response.StatusCode)
+  assert.JSONEq(t, `{"id":1}`, body)
+  response, body = get(t, app, "/text", nil)
+  assert.Equal(t, "text/plain;charset=utf-8", response.Header.Get("Content-Type"))
+  assert.Equal(t, "plain", body)
+  response, body = get(t, app, "/bytes", nil)
+  assert.Equal(t, "application/octet-stream", response.Header.Get("Content-Type"))
+  assert.Equal(t, "\x01\x02", body)
+  response, body = get(t, app, "/empty", nil)
+  assert.Equal(t, 204, response.StatusCode)
+  assert.Empty(t, body)
+  assert.Empty(t, response.Header.Get("Content-Type"))
+  response, body = get(t, app, "/status", nil)
+  assert.Equal(t, 202, response.StatusCode)
+  assert.Equal(t, "Accepted", body)
+}
+
+func Test_Response_Writer_and_Stream(t *testing.T) {
+  app := Express()
+  app.Get("/copy", func(req Request, res Response) {
+    res.Header().Set("Content-Type", "text/csv")
+    io.Copy(res.Writer(), strings.NewReader("a,b\n1,2\n"))
+    fmt.Fprint(res.Writer(), "3,4\n")
+    res.End()
+  })
+  app.Get("/stream", func(req Request, res Response) {
+    var count = 0
+    res.Stream(func(w io.Writer) bool {
+      count++
+      fmt.Fprintf(w, "line %d\n", count)
+      return count < 3
+    })
+  })
+  response, body := get(t, app, "/copy", nil)
+  assert.Equal(t, "text/csv", response.Header.Get("Content-Type"))
+  assert.Equal(t, "a,b\n1,2\n3,4\n", body)
+  _, body = get(t, app, "/stream", nil)
+  assert.Equal(t, "line 1\nline 2\nline 3\n", body)
+}
+
+func Test_Response_SSE_and_Broker(t *testing.T) {
+  app := Express()
+  broker := NewBroker()
+  app.Get("/events", func(req Request, res Response) {
+    stream := res.SSE()
+    stream.Retry(3 * time.Second)
+    stream.Send("resume", req.LastEventID(), "line 1\nline 2")
+    stream.Send("", "", map[string]int{"n": 1})
+    stream.Close()
+  })
+  app.Get("/broker", broker.Handler())
+  response, body := get(t, app, "/events", map[string]string{"Last-Event-ID": "41"})
+  assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+  assert.Equal(t, "retry: 3000\n\nid: 41\nevent: resume\ndata: line 1\ndata: line 2\n\ndata: {\"n\":1}\n\n", body)
+
+  server := httptest.NewServer(app)
+  defer server.Close()
+  response, err := http.Get(server.URL + "/broker")
+  if !assert.NoError(t, err) {
+    t.FailNow()
+  }
+  assert.Eventually(t, func() bool { return broker.Len() == 1 }, time.Second, 10*time.Millisecond)
+  broker.Publish("tick", "1", "hello")
+  reader := bufio.NewReader(response.Body)
+  var lines []string
+  for len(lines) < 3 {
+    line, err := reader.ReadString('\n')
+    if !assert.NoError(t, err) {
+      t.FailNow()
+    }
+    lines = append(lines, line)
+  }
+  assert.Equal(t, []string{"id: 1\n", "event: tick\n", "data: hello\n"}, lines)
+  response.Body.Close()
+  assert.Eventually(t, func() bool { return broker.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_Response_SSE_rejects_injected_fields(t *testing.T) {
+  app := Express()
+  app.Get("/events", func(req Request, res Response) {
+    stream := res.SSE()
+    assert.Equal(t, ErrInvalidEventField, stream.Send("tick\nid: 2", "", "x"))
+    assert.Equal(t, ErrInvalidEventField, stream.Send("", "1\r", "x"))
+    stream.Send("", "", "x\revent: evil\r\ny")
+    stream.Close()
+  })
+  _, body := get(t, app, "/events", nil)
+  assert.Equal(t, "data: x\ndata: event: evil\ndata: y\n\n", body)
+}
+
+func Test_Response_SSE_stops_the_heartbeats_when_the_handler_returns(t *testing.T) {
+  app := Express()
+  app.Get("/events", func(req Request, res Response) {
+    stream := res.SSE()
+    stream.Heartbeat(time.Millisecond)
+    stream.Send("", "", "first")
+    time.Sleep(20 * time.Millisecond)
+    // returns without Close
+  })
+  _, body := get(t, app, "/events", nil)
+  assert.True(t, strings.HasPrefix(body, "data: first\n\n"), body)
+  assert.Equal(t, "", strings.Trim(body[len("data: first\n\n"):], ":\n"))
+}
+
+func Test_Response_Stream_detects_the_client_disconnect(t *testing.T) {
+  app := Express()
+  var result = make(chan bool, 1)
+  var received = make(chan string, 1)
+  app.Post("/stream", func(req Request, res Response) {
+    received <- req.Body("name")[0]
+    result <- res.Stream(func(w io.Writer) bool {
+      io.WriteString(w, "tick\n")
+      time.Sleep(5 * time.Millisecond)
+      return true
+    })
+  })
+  server := httptest.NewServer(app)
+  defer server.Close()
+  conn, err := net.Dial("tcp", server.Listener.Addr().String())
+  if !assert.NoError(t, err) {
+    t.FailNow()
+  }
+  fmt.Fprintf(conn, "POST /stream HTTP/1.1\r\nHost: test\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 8\r\n\r\nname=rob")
+  reader := bufio.NewReader(conn)
+  for {
+    line, err := reader.ReadString('\n')
+    if !assert.NoError(t, err) {
+      t.FailNow()
+    }
+    if strings.HasPrefix(line, "tick") {
+      break
+    }
+  }
+  assert.Equal(t, "rob", <-received)
+  conn.Close()
+  select {
+  case gone := <-result:
+    assert.True(t, gone)
+  case <-time.After(2 * time.Second):
+    t.Fatal("the disconnect was not detected")
+  }
+}
@@ -0,0 +1,106 @@
+// Package goexpress handler adapts the net/http handlers and middlewares
+// so the existing net/http ecosystem can be mounted on the express router
+//
+//   app.Use(func(next http.Handler) http.Handler { ... })
+//   app.Get("/static/(.*)", HTTPHandler(http.StripPrefix("/static/", http.FileServer(dir))))
+//
+// Middlewares which only inspect the request, set headers or derive the
+// request context work as they do in net/http; a middleware wrapping the
+// http.ResponseWriter only sees what is written through its own writer.
+package goexpress
+
+import (
+  "bufio"
+  "net"
+  "net/http"
+)
+
+// responseWriter is a http.ResponseWriter view of an express response
+type responseWriter struct {
+  res *response
+}
+
+// newResponseWriter returns a http.ResponseWriter writing to the response
+func newResponseWriter(res *response) *responseWriter {
+  return &responseWriter{res: res}
+}
+
+// Header returns the response header map
+func (w *responseWriter) Header() http.Header {
+  return w.res.response.Header()
+}
+
+// WriteHeader sets the response status
+func (w *responseWriter) WriteHeader(code int) {
+  if w.res.header.CanSendHeader() && w.res.header.BasicSent() == false {
+    w.res.header.SetStatus(code)
+  }
+}
+
+// Write writes the bytes as a chunk, flushing the headers on first write
+func (w *responseWriter) Write(bytes []byte) (int, error) {
+  if w.res.header.BasicSent() == false {
+    w.res.cookie.Finish()
+    w.res.header.FlushHeaders()
+  }
+  if len(bytes) == 0 {
+    return 0, nil
+  }
+  if err := w.res.WriteBytes(bytes); err != nil {
+    return 0, err
+  }
+  return len(bytes), nil
+}
+
+// Flush implements http.Flusher, chunks are flushed as they are written
+func (w *responseWriter) Flush() {
+  w.res.writer.Flush()
+}
+
+// Hijack implements http.Hijacker, the caller takes over the connection
+// and the express response is considered ended
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+  w.res.ended = true
+  return w.res.connection, w.res.writer, nil
+}
+
+// HTTPHandler adapts a http.Handler to a Middleware, the handler is
+// terminal and the response is ended once it returns
+func HTTPHandler(handler http.Handler) Middleware {
+  return func(req Request, res Response) {
+    var response = res.(*response)
+    handler.ServeHTTP(newResponseWriter(response), req.GetRaw())
+    if response.HasEnded() == false {
+      response.End()
+    }
+  }
+}
+
+// HTTPHandlerFunc adapts a http.HandlerFunc style function to a Middleware
+func HTTPHandlerFunc(handler func(http.ResponseWriter, *http.Request)) Middleware {
+  return HTTPHandler(http.HandlerFunc(handler))
+}
+
+// HTTPMiddleware adapts a standard func(http.Handler) http.Handler middleware,
+// calling the next handler continues the express chain with the request it
+// was called with, not calling it ends the response
+func HTTPMiddleware(middleware func(http.Handler) http.Handler) Middleware {
+  return func(req Request, res Response) {
+    var request = req.(*request)
+    var response = res.(*response)
+    var next = request.next
+    var called = false
+    var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      called = true
+      // pick up the request derived by the middleware, i.e. a new context
+      request.ref = r
+      if next != nil {
+        next()
+      }
+    }))
+    handler.ServeHTTP(newResponseWriter(response), request.ref)
+    if called == false && response.HasEnded() == false {
+      response.End()
+    }
+  }
+}
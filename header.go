@@ -6,7 +6,6 @@ package goexpress
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 )
@@ -19,6 +18,7 @@ type header struct {
 	bodySent   bool
 	basicSent  bool
 	hasLength  bool
+	chunked    bool // the response has a chunked body
 	StatusCode int
 	ProtoMajor int
 	ProtoMinor int
@@ -95,25 +95,26 @@ func (h *header) SetLength(length *int) {
 	h.hasLength = true
 }
 
-// FlushHeaders flushes Headers
+// FlushHeaders flushes Headers, it returns false once they are sent
 func (h *header) FlushHeaders() bool {
 	if h.bodySent == true {
-		log.Panic("Cannot send headers in middle of body")
+		// already out, a late Redirect or error page keeps the sent status
 		return false
 	}
 	if h.basicSent == false {
 		h.sendBasics()
 	}
 	// write the latest headers
-	if h.Get("Content-Type") == "" {
+	if h.Get("Content-Type") == "" && h.chunked {
 		h.Set("Content-Type", "text/html;charset=utf-8")
 	}
 	if err := h.response.Header().Write(h.writer); err != nil {
 		return false
 	}
-	var chunkSize = fmt.Sprintf("%x", 0)
-	h.writer.WriteString(chunkSize + "\r\n" + "\r\n")
+	// terminate the header block, everything after this is body
+	h.writer.WriteString("\r\n")
 	h.writer.Writer.Flush()
+	h.bodySent = true
 	return true
 
 }
@@ -148,12 +149,30 @@ func (h *header) SetStatus(code int) {
 	h.StatusCode = code
 }
 
+// bodilessStatus tells if a status never has a body, 1xx, 204 and 304
+func bodilessStatus(code int) bool {
+	return (code >= 100 && code < 200) || code == 204 || code == 304
+}
+
 func (h *header) sendBasics() {
 	if h.StatusCode == 0 {
 		h.StatusCode = 200
 	}
-	fmt.Fprintf(h.writer, "HTTP/%d.%d %03d %s\r\n", h.ProtoMajor, h.ProtoMinor, h.StatusCode, statusCodeMap[h.StatusCode])
-	h.Set("transfer-encoding", "chunked")
-	h.Set("connection", "keep-alive")
+	var reason, found = statusCodeMap[h.StatusCode]
+	if !found {
+		reason = http.StatusText(h.StatusCode)
+	}
+	fmt.Fprintf(h.writer, "HTTP/%d.%d %03d %s\r\n", h.ProtoMajor, h.ProtoMinor, h.StatusCode, reason)
+	h.chunked = !bodilessStatus(h.StatusCode)
+	if h.chunked {
+		h.Set("transfer-encoding", "chunked")
+		// a chunked body can not carry a length as well, RFC 7230 3.3.2
+		h.Del("content-length")
+	} else {
+		h.Del("transfer-encoding")
+		h.Del("content-length")
+	}
+	// the connection is hijacked and closed once the response ends
+	h.Set("connection", "close")
 	h.basicSent = true
 }
@@ -0,0 +1,135 @@
+// Package goexpress headerset gives access to the request headers
+// keeping every value of a repeated header, the names are looked up
+// ignoring their case
+//
+//   req.Header().Get("x-forwarded-for")     // "10.0.0.1, 10.0.0.2"
+//   req.Header().Values("X-Forwarded-For")  // ["10.0.0.1", "10.0.0.2"]
+//   req.Header().Range(func(key string, values []string) bool {
+//     log.Print(key, values)
+//     return true
+//   })
+package goexpress
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/textproto"
+  "sort"
+  "strings"
+  "time"
+)
+
+// HeaderSet holds the request headers by their canonical names
+type HeaderSet struct {
+  header http.Header
+}
+
+// newHeaderSet returns a set holding a copy of the headers
+func newHeaderSet(header http.Header) *HeaderSet {
+  var set = &HeaderSet{header: make(http.Header, len(header))}
+  for key, values := range header {
+    key = textproto.CanonicalMIMEHeaderKey(key)
+    set.header[key] = append(set.header[key], values...)
+  }
+  return set
+}
+
+// Get returns the values of a header joined with ",", the Cookie
+// values are joined with "; " as they are sent
+func (h *HeaderSet) Get(key string) string {
+  key = textproto.CanonicalMIMEHeaderKey(key)
+  if key == "Cookie" {
+    return strings.Join(h.header[key], "; ")
+  }
+  return strings.Join(h.header[key], ",")
+}
+
+// Values returns every value of a header as sent, nil if it is absent
+func (h *HeaderSet) Values(key string) []string {
+  return h.header[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// Has tells if the header was sent, even with an empty value
+func (h *HeaderSet) Has(key string) bool {
+  _, found := h.header[textproto.CanonicalMIMEHeaderKey(key)]
+  return found
+}
+
+// Set replaces the values of a header
+func (h *HeaderSet) Set(key string, value string) {
+  h.header[textproto.CanonicalMIMEHeaderKey(key)] = []string{value}
+}
+
+// Add appends a value to a header
+func (h *HeaderSet) Add(key string, value string) {
+  key = textproto.CanonicalMIMEHeaderKey(key)
+  h.header[key] = append(h.header[key], value)
+}
+
+// Del removes a header
+func (h *HeaderSet) Del(key string) {
+  delete(h.header, textproto.CanonicalMIMEHeaderKey(key))
+}
+
+// Keys returns the canonical names of the headers in sorted order
+func (h *HeaderSet) Keys() []string {
+  var keys = make([]string, 0, len(h.header))
+  for key := range h.header {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// Len returns the number of the headers
+func (h *HeaderSet) Len() int {
+  return len(h.header)
+}
+
+// Range calls the callback with every header in sorted order until it
+// returns false
+func (h *HeaderSet) Range(callback func(key string, values []string) bool) {
+  for _, key := range h.Keys() {
+    if !callback(key, h.header[key]) {
+      return
+    }
+  }
+}
+
+// GetOr returns the value of a header or the fallback if it is absent
+func (h *HeaderSet) GetOr(key string, fallback string) string {
+  if !h.Has(key) {
+    return fallback
+  }
+  return h.Get(key)
+}
+
+// Int returns the value of a header as int
+func (h *HeaderSet) Int(key string) (int, error) {
+  return entryInt(key, h.Get(key), h.Has(key))
+}
+
+// Bool returns the value of a header as bool, see strconv.ParseBool
+func (h *HeaderSet) Bool(key string) (bool, error) {
+  return entryBool(key, h.Get(key), h.Has(key))
+}
+
+// Float returns the value of a header as float64
+func (h *HeaderSet) Float(key string) (float64, error) {
+  return entryFloat(key, h.Get(key), h.Has(key))
+}
+
+// Duration returns the value of a header as time.Duration
+func (h *HeaderSet) Duration(key string) (time.Duration, error) {
+  return entryDuration(key, h.Get(key), h.Has(key))
+}
+
+// MarshalJSON encodes the headers as a JSON object of value lists
+func (h *HeaderSet) MarshalJSON() ([]byte, error) {
+  return json.Marshal(h.header)
+}
+
+// Clone returns the headers as a http.Header
+func (h *HeaderSet) Clone() http.Header {
+  return h.header.Clone()
+}
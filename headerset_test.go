@@ -0,0 +1,31 @@
+package goexpress
+
+import (
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_HeaderSet_keeps_every_value(t *testing.T) {
+  raw := httptest.NewRequest("GET", "/", nil)
+  raw.Header.Add("X-Tag", "a,b")
+  raw.Header.Add("X-Tag", "c")
+  raw.Header.Add("Cookie", "a=1")
+  raw.Header.Add("Cookie", "b=2")
+  header := newRequest(raw, Express().(*express), newLocals()).Header()
+
+  assert.Equal(t, "a,b,c", header.Get("x-tag"))
+  assert.Equal(t, []string{"a,b", "c"}, header.Values("X-TAG"))
+  assert.Equal(t, "a=1; b=2", header.Get("cookie"))
+  assert.True(t, header.Has("x-tag"))
+  assert.False(t, header.Has("x-missing"))
+  assert.Equal(t, []string{"Cookie", "X-Tag"}, header.Keys())
+
+  var visited []string
+  header.Range(func(key string, values []string) bool {
+    visited = append(visited, key)
+    return false
+  })
+  assert.Equal(t, []string{"Cookie"}, visited)
+}
@@ -0,0 +1,96 @@
+// Package goexpress httperror defines the HTTPError type which carries
+// the status and the public message of a failed request along with the
+// internal cause which is only logged, it is never sent to the client
+// unless the env is set to "development"
+package goexpress
+
+import (
+  "errors"
+  "fmt"
+  "net/http"
+)
+
+// HTTPError is an error with a HTTP status
+type HTTPError struct {
+  // Status is the HTTP status code sent to the client
+  Status int
+  // Message is the public message sent to the client
+  Message string
+  // Cause is the internal error, it is only exposed once the env is set
+  // to "development"
+  Cause error
+  // Details are additional public values sent along the message
+  Details map[string]interface{}
+}
+
+// NewHTTPError returns a HTTPError, the message defaults to the status text
+func NewHTTPError(status int, message string) *HTTPError {
+  if message == "" {
+    message = http.StatusText(status)
+  }
+  return &HTTPError{Status: status, Message: message}
+}
+
+// WithCause sets the internal cause of the error
+func (e *HTTPError) WithCause(err error) *HTTPError {
+  e.Cause = err
+  return e
+}
+
+// WithDetail adds a public detail to the error
+func (e *HTTPError) WithDetail(key string, value interface{}) *HTTPError {
+  if e.Details == nil {
+    e.Details = make(map[string]interface{})
+  }
+  e.Details[key] = value
+  return e
+}
+
+// Error returns the status, message and the cause as string
+func (e *HTTPError) Error() string {
+  if e.Cause != nil {
+    return fmt.Sprintf("%d %s: %v", e.Status, e.Message, e.Cause)
+  }
+  return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Unwrap returns the internal cause
+func (e *HTTPError) Unwrap() error {
+  return e.Cause
+}
+
+// httpErrorer is implemented by the errors which map to a HTTPError
+type httpErrorer interface {
+  HTTPError() *HTTPError
+}
+
+// toHTTPError returns the HTTPError in the error chain, any other
+// error is an Internal Server Error caused by it
+func toHTTPError(err error) *HTTPError {
+  var httpErr *HTTPError
+  if errors.As(err, &httpErr) {
+    return httpErr
+  }
+  var errorer httpErrorer
+  if errors.As(err, &errorer) {
+    return errorer.HTTPError()
+  }
+  return NewHTTPError(500, "").WithCause(err)
+}
+
+// Handler is a route handler which can return an error, the error is
+// passed to the app error handlers, see Handle
+type Handler func(request Request, response Response) error
+
+// Handle adapts a Handler to a Middleware
+//
+//   app.Get("/user/:id", Handle(func(req Request, res Response) error {
+//     return NewHTTPError(404, "user not found")
+//   }))
+func Handle(handler Handler) Middleware {
+  return func(req Request, res Response) {
+    if err := handler(req, res); err != nil {
+      res.Fail(err)
+    }
+  }
+}
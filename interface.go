@@ -4,6 +4,7 @@ import (
   "bufio"
   "context"
   "encoding/json"
+  "io"
   "net"
   "net/http"
   "net/url"
@@ -21,21 +22,70 @@ type Request interface {
   // Cookie returns a cookie object to read from
   Cookie() Cookie
   // Header returns header set to read from
-  Header() *EntrySet
+  Header() *HeaderSet
   // Params returns a params set
   Params() *EntrySet
+  // ID returns the request identifier, see the "request id header" setting
+  ID() string
+  // LastEventID returns the Last-Event-ID header of a reconnecting event stream
+  LastEventID() string
   // Method defines the HTTP request method
   Method() string
+  // IP returns the client address, see the "trust proxy" setting
+  IP() string
+  // IPs returns the addresses from the client to the last trusted proxy
+  IPs() []string
+  // Protocol returns "http" or "https" as seen by the client
+  Protocol() string
+  // Secure tells if the client used https
+  Secure() bool
+  // Hostname returns the host the client asked for, without the port
+  Hostname() string
+  // Subdomains returns the subdomains of the hostname, the nearest first
+  Subdomains() []string
+  // ParseBody reads the body, it is called on the first use of Body,
+  // Files, JSON, Decode and Bind
+  ParseBody() error
   // Body returns form key value list
   Body(key string) []string
   // Query returns query key value list
   Query(key string) []string
+  // QueryTree returns the query string parsed into nested maps and lists
+  QueryTree() (map[string]interface{}, error)
+  // BodyTree returns the form body parsed into nested maps and lists
+  BodyTree() (map[string]interface{}, error)
   // JSON returns json decoder for a json input body
   JSON() *json.Decoder
   // IsJSON tells if a request has json body
   IsJSON() bool
+  // RawBody returns the body as sent, buffered so it can be parsed afterwards
+  RawBody() ([]byte, error)
+  // Decode decodes the body with the parser registered for its media type
+  Decode(v interface{}) error
   // Files returns all the files attached with the request
   Files() []*File
+  // NextPart streams the next file of a multipart body
+  NextPart() (*File, error)
+  // EachFile streams every file of a multipart body to the callback
+  EachFile(callback func(file *File) error) error
+  // SetLimits replaces the body limits before the body is read
+  SetLimits(limits Limits) error
+  // Locals returns the per-request store shared with the Response
+  Locals() *Locals
+  // Accepts returns the best of the offered media types or extensions
+  Accepts(offers ...string) string
+  // AcceptsLanguages returns the best of the offered languages
+  AcceptsLanguages(offers ...string) string
+  // AcceptsEncodings returns the best of the offered content encodings
+  AcceptsEncodings(offers ...string) string
+  // AcceptsCharsets returns the best of the offered charsets
+  AcceptsCharsets(offers ...string) string
+  // Fresh tells if the client copy of the response is still valid
+  Fresh() bool
+  // Stale is the opposite of Fresh
+  Stale() bool
+  // Bind fills a struct from the body, query, params and headers and validates it
+  Bind(dst interface{}) error
 }
 
 // Response defines HTTP response wrapper interface
@@ -43,7 +93,22 @@ type Response interface {
   Cookie() Cookie
   Header() Header
   JSON(content interface{})
+  // Status sets the response status, i.e. res.Status(201).JSON(user)
+  Status(code int) Response
+  // Send sends a string, []byte, io.Reader or a JSON encoded value
+  Send(body interface{})
+  // Text sends a plain text body
+  Text(body string)
+  // HTML sends a HTML body
+  HTML(body string)
+  // SendStatus sends the status with its reason phrase as body
+  SendStatus(code int)
+  // NoContent sends a 204 No Content
+  NoContent()
+  // Error sends a HTTPError with the given status and message
   Error(status int, str string)
+  // Fail passes an error to the app error handlers
+  Fail(err error)
   GetBuffer() *bufio.ReadWriter
   GetConnection() net.Conn
   GetRaw() http.ResponseWriter
@@ -54,6 +119,19 @@ type Response interface {
   WriteBytes(bytes []byte) error
   Write(content string) Response
   Render(path string, data interface{})
+  // Writer returns a buffered io.Writer of the body
+  Writer() *BodyWriter
+  // Stream calls the step function until it returns false or the client goes away
+  Stream(step func(w io.Writer) bool) bool
+  // SSE starts a server-sent event stream
+  SSE() *EventStream
+  // CheckPreconditions answers with a 304 or a 412 and returns false
+  // when the conditional headers do not match the ETag and Last-Modified,
+  // the handlers of the unsafe methods call it before changing anything
+  CheckPreconditions() bool
+  // Format calls the handler of the best accepted media type or sends a 406
+  Format(handlers map[string]Middleware)
+  Locals() *Locals
 }
 
 // Header defines HTTP header interface
@@ -76,6 +154,8 @@ type Cookie interface {
 }
 
 // Router is an interface wrapper
+// Use takes a Middleware, a Handler, a Router, a http.Handler, a
+// http.HandlerFunc or a net/http style func(http.Handler) http.Handler middleware
 type Router interface {
   Get(url string, middleware Middleware) Router
   Post(url string, middleware Middleware) Router
@@ -89,6 +169,7 @@ type Router interface {
 
 // ExpressInterface is the Public Interface to allow access to express struct's member functions
 type ExpressInterface interface {
+  http.Handler
   Use(interface{}) ExpressInterface
   Get(string, Middleware) ExpressInterface
   Post(string, Middleware) ExpressInterface
@@ -96,7 +177,18 @@ type ExpressInterface interface {
   Patch(string, Middleware) ExpressInterface
   Delete(string, Middleware) ExpressInterface
   Options(string, Middleware) ExpressInterface
+  NotFound(Middleware) ExpressInterface
+  OnError(ErrorHandler) ExpressInterface
+  BodyParser(string, BodyParser) ExpressInterface
+  Limits(Limits) ExpressInterface
+  Set(string, interface{}) ExpressInterface
+  Enable(string) ExpressInterface
+  Disable(string) ExpressInterface
+  Enabled(string) bool
+  Settings() *Settings
+  // Deprecated: use Set instead
   SetProp(string, interface{}) ExpressInterface
+  // Deprecated: use Settings().Get instead
   GetProp(string, interface{}) interface{}
   Start(string) ExpressInterface
   ShutdownTimeout(t time.Duration) ExpressInterface
@@ -0,0 +1,78 @@
+// Package goexpress locals provides a per-request key value store
+// The same store is shared by goexpress.Request and goexpress.Response
+// so middlewares can hand over values (current user, session etc.)
+// to the handlers and templates down the chain
+package goexpress
+
+// Locals is a per-request store of arbitrary values
+type Locals struct {
+  values map[string]interface{}
+}
+
+// newLocals returns an empty locals store
+func newLocals() *Locals {
+  return &Locals{values: make(map[string]interface{})}
+}
+
+// Get returns the raw value stored under the key
+func (l *Locals) Get(key string) interface{} {
+  return l.values[key]
+}
+
+// Set stores a value under the key
+func (l *Locals) Set(key string, value interface{}) *Locals {
+  l.values[key] = value
+  return l
+}
+
+// Has tells whether a value is stored under the key
+func (l *Locals) Has(key string) bool {
+  _, found := l.values[key]
+  return found
+}
+
+// Del removes the value stored under the key
+func (l *Locals) Del(key string) *Locals {
+  delete(l.values, key)
+  return l
+}
+
+// Keys returns all the keys present in the store
+func (l *Locals) Keys() []string {
+  keys := make([]string, 0, len(l.values))
+  for key := range l.values {
+    keys = append(keys, key)
+  }
+  return keys
+}
+
+// All returns a copy of all the values in the store
+func (l *Locals) All() map[string]interface{} {
+  values := make(map[string]interface{}, len(l.values))
+  for key, value := range l.values {
+    values[key] = value
+  }
+  return values
+}
+
+// Local returns the value stored under the key as type T,
+// ok is false if the key is missing or holds a value of another type
+//
+//   user, ok := goexpress.Local[*User](req.Locals(), "user")
+func Local[T any](l *Locals, key string) (value T, ok bool) {
+  raw, found := l.values[key]
+  if !found {
+    return value, false
+  }
+  value, ok = raw.(T)
+  return value, ok
+}
+
+// LocalOr returns the value stored under the key as type T or the
+// fallback value if the key is missing or holds a value of another type
+func LocalOr[T any](l *Locals, key string, fallback T) T {
+  if value, ok := Local[T](l, key); ok {
+    return value
+  }
+  return fallback
+}
@@ -0,0 +1,31 @@
+package goexpress
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_Local_returns_typed_values_from_the_store(t *testing.T) {
+  l := newLocals()
+  l.Set("user", "rob").Set("id", 10)
+  user, ok := Local[string](l, "user")
+  assert.True(t, ok)
+  assert.Equal(t, "rob", user)
+  // a value of a different type is not returned
+  _, ok = Local[string](l, "id")
+  assert.False(t, ok)
+  // missing keys fallback to the default
+  assert.Equal(t, 5, LocalOr(l, "missing", 5))
+  assert.Equal(t, 10, LocalOr(l, "id", 5))
+}
+
+func Test_templateData_merges_locals_with_map_data(t *testing.T) {
+  res := &response{locals: newLocals()}
+  res.locals.Set("user", "rob").Set("title", "locals")
+  data := res.templateData(map[string]interface{}{"title": "data"})
+  assert.Equal(t, map[string]interface{}{"user": "rob", "title": "data"}, data)
+  // structs are passed through untouched
+  type ctx struct{ Name string }
+  assert.Equal(t, ctx{"foo"}, res.templateData(ctx{"foo"}))
+}
@@ -0,0 +1,155 @@
+package goexpress
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
+  "io"
+  "mime/multipart"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+// newMultipartRequest returns a request with the form values and the files
+func newMultipartRequest(t *testing.T, values map[string]string, files map[string]string) *request {
+  var body bytes.Buffer
+  writer := multipart.NewWriter(&body)
+  for key, value := range values {
+    assert.NoError(t, writer.WriteField(key, value))
+  }
+  for name, content := range files {
+    part, err := writer.CreateFormFile(name, name+".txt")
+    assert.NoError(t, err)
+    io.WriteString(part, content)
+  }
+  assert.NoError(t, writer.Close())
+  raw := httptest.NewRequest("POST", "/upload", &body)
+  raw.Header.Set("Content-Type", writer.FormDataContentType())
+  return newRequest(raw, Express().(*express), newLocals())
+}
+
+func Test_EachFile_streams_the_multipart_files(t *testing.T) {
+  req := newMultipartRequest(t, map[string]string{"title": "docs"}, map[string]string{"doc": "content"})
+  var streamed = map[string]string{}
+  err := req.EachFile(func(file *File) error {
+    content, err := io.ReadAll(file)
+    streamed[file.FormName] = string(content)
+    return err
+  })
+  assert.NoError(t, err)
+  assert.Equal(t, map[string]string{"doc": "content"}, streamed)
+  assert.Equal(t, []string{"docs"}, req.Body("title"))
+  // the buffered mode is not available anymore
+  assert.Empty(t, req.Files())
+}
+
+func Test_NextPart_fails_once_the_body_is_buffered(t *testing.T) {
+  req := newMultipartRequest(t, nil, map[string]string{"doc": "content"})
+  assert.Len(t, req.Files(), 1)
+  _, err := req.NextPart()
+  assert.Equal(t, ErrBodyConsumed, err)
+}
+
+func Test_Limits_reject_the_large_and_disallowed_files(t *testing.T) {
+  req := newMultipartRequest(t, nil, map[string]string{"doc": "a long content"})
+  assert.NoError(t, req.SetLimits(Limits{MaxFileSize: 4}))
+  err := req.ParseBody()
+  assert.Equal(t, 413, toHTTPError(err).Status)
+
+  req = newMultipartRequest(t, nil, map[string]string{"doc": "plain text"})
+  assert.NoError(t, req.SetLimits(Limits{AllowedTypes: []string{"image/*"}}))
+  err = req.ParseBody()
+  assert.Equal(t, 415, toHTTPError(err).Status)
+  assert.Equal(t, ErrBodyConsumed, req.SetLimits(Limits{}))
+
+  req = newMultipartRequest(t, nil, map[string]string{"doc": "plain text"})
+  assert.NoError(t, req.SetLimits(Limits{MaxMemory: 2, AllowedTypes: []string{"text/plain"}}))
+  files := req.Files()
+  if assert.Len(t, files, 1) {
+    content, _ := io.ReadAll(files[0])
+    assert.Equal(t, "plain text", string(content))
+    assert.Equal(t, "text/plain", files[0].ContentType)
+    assert.Equal(t, int64(10), files[0].Size)
+  }
+}
+
+func Test_SaveTo_writes_the_upload_and_the_spilled_files_are_removed(t *testing.T) {
+  req := newMultipartRequest(t, nil, map[string]string{"doc": "spilled to the disk"})
+  req.app.settings.Set(SettingUploadDir, t.TempDir())
+  assert.NoError(t, req.SetLimits(Limits{MaxMemory: 4}))
+  files := req.Files()
+  if !assert.Len(t, files, 1) || !assert.Len(t, req.tempFiles, 1) {
+    return
+  }
+  spilled := req.tempFiles[0]
+  assert.Equal(t, req.app.settings.String(SettingUploadDir), filepath.Dir(spilled))
+
+  path := filepath.Join(t.TempDir(), "doc.txt")
+  assert.NoError(t, files[0].SaveTo(path))
+  content, err := os.ReadFile(path)
+  assert.NoError(t, err)
+  assert.Equal(t, "spilled to the disk", string(content))
+  sum := sha256.Sum256(content)
+  assert.Equal(t, hex.EncodeToString(sum[:]), files[0].SHA256)
+
+  req.removeTempFiles()
+  _, err = os.Stat(spilled)
+  assert.True(t, os.IsNotExist(err))
+}
+
+func Test_Limits_bound_the_total_size_of_the_form_values(t *testing.T) {
+  var values = map[string]string{}
+  for i := 0; i < 20; i++ {
+    values["field"+strconv.Itoa(i)] = strings.Repeat("a", 900*1024)
+  }
+  req := newMultipartRequest(t, values, nil)
+  err := req.ParseBody()
+  assert.Equal(t, 413, toHTTPError(err).Status)
+  assert.LessOrEqual(t, req.formSize, DefaultLimits.MaxFormSize)
+
+  req = newMultipartRequest(t, map[string]string{"title": "docs"}, nil)
+  assert.NoError(t, req.ParseBody())
+  assert.Equal(t, []string{"docs"}, req.Body("title"))
+}
+
+func Test_Body_and_Files_answer_a_breached_limit(t *testing.T) {
+  app := Express()
+  app.Post("/upload", WithLimits(Limits{MaxFileSize: 4}))
+  app.Post("/upload", func(req Request, res Response) {
+    res.Write("files=" + strconv.Itoa(len(req.Files())))
+  })
+  app.Post("/form", WithLimits(Limits{MaxBodySize: 4}))
+  app.Post("/form", func(req Request, res Response) {
+    res.Write("name=" + strings.Join(req.Body("name"), ","))
+  })
+  server := httptest.NewServer(app)
+  defer server.Close()
+
+  var body bytes.Buffer
+  writer := multipart.NewWriter(&body)
+  part, _ := writer.CreateFormFile("doc", "doc.txt")
+  io.WriteString(part, "a long content")
+  writer.Close()
+  response, err := http.Post(server.URL+"/upload", writer.FormDataContentType(), &body)
+  if assert.NoError(t, err) {
+    content, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    assert.Equal(t, 413, response.StatusCode)
+    assert.NotContains(t, string(content), "files=")
+  }
+
+  response, err = http.Post(server.URL+"/form", "application/x-www-form-urlencoded", strings.NewReader("name=rob"))
+  if assert.NoError(t, err) {
+    content, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    assert.Equal(t, 413, response.StatusCode)
+    assert.NotContains(t, string(content), "name=")
+  }
+}
@@ -0,0 +1,236 @@
+// Package goexpress negotiate parses the Accept family of headers
+// and picks the best of the offered values as per their q-values
+//
+// An offer takes the q-value of the most specific entry matching it,
+// the highest q-value wins and a tie goes to the offer matching the
+// earlier entry, then to the earlier offer. An empty header accepts
+// the first offer.
+package goexpress
+
+import (
+  "mime"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// acceptSpec is a single entry of an Accept header
+type acceptSpec struct {
+  value string
+  q     float64
+}
+
+// parseAccept returns the entries of an Accept header ordered by
+// their q-value, the entries with q=0 are kept as they exclude the
+// values they match
+func parseAccept(header string) []acceptSpec {
+  var specs []acceptSpec
+  for _, part := range strings.Split(header, ",") {
+    part = strings.TrimSpace(part)
+    if part == "" {
+      continue
+    }
+    var spec = acceptSpec{q: 1}
+    params := strings.Split(part, ";")
+    spec.value = strings.ToLower(strings.TrimSpace(params[0]))
+    for _, param := range params[1:] {
+      pair := strings.SplitN(strings.TrimSpace(param), "=", 2)
+      if len(pair) == 2 && strings.TrimSpace(pair[0]) == "q" {
+        if q, err := strconv.ParseFloat(strings.TrimSpace(pair[1]), 64); err == nil {
+          spec.q = q
+        }
+      }
+    }
+    specs = append(specs, spec)
+  }
+  sort.SliceStable(specs, func(i, j int) bool {
+    return specs[i].q > specs[j].q
+  })
+  return specs
+}
+
+// acceptMatcher returns how specific an entry matching the offer is,
+// -1 if it does not match
+type acceptMatcher func(spec string, offer string) int
+
+// mediaTypeMatches tells if a media range like "text/*" covers the media type
+func mediaTypeMatches(mediaRange string, mediaType string) bool {
+  return matchMediaType(mediaRange, mediaType) != -1
+}
+
+// matchMediaType matches a media range, "*/*" and "text/*" included
+func matchMediaType(mediaRange string, mediaType string) int {
+  switch {
+  case mediaRange == mediaType:
+    return 2
+  case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+    return 1
+  case mediaRange == "*/*" || mediaRange == "*":
+    return 0
+  }
+  return -1
+}
+
+// matchLanguage matches a language tag, "en" covers "en-US"
+func matchLanguage(spec string, offer string) int {
+  switch {
+  case spec == offer:
+    return 2
+  case strings.HasPrefix(offer, spec+"-"):
+    return 1
+  case spec == "*":
+    return 0
+  }
+  return -1
+}
+
+// matchToken matches the encodings and the charsets
+func matchToken(spec string, offer string) int {
+  switch {
+  case spec == offer:
+    return 1
+  case spec == "*":
+    return 0
+  }
+  return -1
+}
+
+// negotiate returns the offer best matching the header, the first offer
+// if the header is empty and "" if nothing is acceptable
+func negotiate(header string, offers []string, match acceptMatcher) string {
+  if len(offers) == 0 {
+    return ""
+  }
+  if strings.TrimSpace(header) == "" {
+    return offers[0]
+  }
+  specs := parseAccept(header)
+  var best = ""
+  var bestQ, bestIndex = 0.0, len(specs)
+  for _, offer := range offers {
+    var q, index, specificity = 0.0, -1, -1
+    for i, spec := range specs {
+      if s := match(spec.value, strings.ToLower(offer)); s > specificity {
+        q, index, specificity = spec.q, i, s
+      }
+    }
+    if index == -1 || q <= 0 {
+      continue
+    }
+    if q > bestQ || (q == bestQ && index < bestIndex) {
+      best, bestQ, bestIndex = offer, q, index
+    }
+  }
+  return best
+}
+
+// negotiateMediaType returns the offer best matching the Accept header
+func negotiateMediaType(header string, offers ...string) string {
+  return negotiate(header, offers, matchMediaType)
+}
+
+// offerMediaType expands a file extension offer like "json" to its
+// media type
+func offerMediaType(offer string) string {
+  if strings.Contains(offer, "/") {
+    return offer
+  }
+  if mediaType, _ := parseMediaType(mime.TypeByExtension("." + strings.TrimPrefix(offer, "."))); mediaType != "" {
+    return mediaType
+  }
+  return offer
+}
+
+// Accepts returns the best of the offered media types as per the
+// Accept header, the offers can be extensions like "json" or "html"
+// and are returned as given, "" if none is acceptable
+func (req *request) Accepts(offers ...string) string {
+  var types = make([]string, len(offers))
+  for i, offer := range offers {
+    types[i] = offerMediaType(offer)
+  }
+  best := negotiate(req.acceptHeader("Accept"), types, matchMediaType)
+  for i, mediaType := range types {
+    if best != "" && mediaType == best {
+      return offers[i]
+    }
+  }
+  return ""
+}
+
+// AcceptsLanguages returns the best of the offered languages as per
+// the Accept-Language header
+func (req *request) AcceptsLanguages(offers ...string) string {
+  return negotiate(req.acceptHeader("Accept-Language"), offers, matchLanguage)
+}
+
+// AcceptsEncodings returns the best of the offered encodings as per the
+// Accept-Encoding header, "identity" is acceptable unless excluded
+func (req *request) AcceptsEncodings(offers ...string) string {
+  header := req.acceptHeader("Accept-Encoding")
+  lower := strings.ToLower(header)
+  if strings.TrimSpace(header) != "" && !strings.Contains(lower, "identity") && !strings.Contains(lower, "*") {
+    header += ", identity;q=0.001"
+  }
+  return negotiate(header, offers, matchToken)
+}
+
+// AcceptsCharsets returns the best of the offered charsets as per the
+// Accept-Charset header
+func (req *request) AcceptsCharsets(offers ...string) string {
+  return negotiate(req.acceptHeader("Accept-Charset"), offers, matchToken)
+}
+
+// acceptHeader returns all the values of an Accept header joined
+func (req *request) acceptHeader(key string) string {
+  return strings.Join(req.ref.Header.Values(key), ",")
+}
+
+// Format calls the handler of the media type best matching the Accept
+// header, the keys can be extensions like "json" and the ties go to
+// the keys in sorted order, the handler of the "default" key is called
+// when no type is acceptable, otherwise a 406 Not Acceptable is sent
+//
+//   res.Format(map[string]Middleware{
+//     "html": func(req Request, res Response) { res.Render("user.html", user) },
+//     "json": func(req Request, res Response) { res.JSON(user) },
+//   })
+func (res *response) Format(handlers map[string]Middleware) {
+  var offers []string
+  for key := range handlers {
+    if key != "default" {
+      offers = append(offers, key)
+    }
+  }
+  sort.Strings(offers)
+  res.addVary("Accept")
+  best := res.request.Accepts(offers...)
+  if best == "" {
+    if handler, found := handlers["default"]; found {
+      handler(res.request, res)
+      return
+    }
+    var types = make([]string, len(offers))
+    for i, offer := range offers {
+      types[i] = offerMediaType(offer)
+    }
+    res.Fail(NewHTTPError(406, "").WithDetail("accepts", types))
+    return
+  }
+  res.header.Set("Content-Type", offerMediaType(best))
+  handlers[best](res.request, res)
+}
+
+// addVary adds a request header to the Vary header of the response
+func (res *response) addVary(key string) {
+  vary := res.header.Get("Vary")
+  for _, item := range strings.Split(vary, ",") {
+    if strings.EqualFold(strings.TrimSpace(item), key) || strings.TrimSpace(item) == "*" {
+      return
+    }
+  }
+  if vary != "" {
+    key = vary + ", " + key
+  }
+  res.header.Set("Vary", key)
+}
@@ -0,0 +1,45 @@
+package goexpress
+
+import (
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_Accepts_picks_the_best_offer(t *testing.T) {
+  raw := httptest.NewRequest("GET", "/", nil)
+  raw.Header.Set("Accept", "text/html;q=0.5, application/json, */*;q=0.1")
+  raw.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, en;q=0.8")
+  raw.Header.Set("Accept-Encoding", "gzip;q=0.5, br")
+  req := newRequest(raw, Express().(*express), newLocals())
+
+  assert.Equal(t, "json", req.Accepts("html", "json"))
+  assert.Equal(t, "text/html", req.Accepts("text/plain", "text/html"))
+  assert.Equal(t, "en-US", req.AcceptsLanguages("de", "en-US"))
+  assert.Equal(t, "br", req.AcceptsEncodings("gzip", "br"))
+  assert.Equal(t, "identity", req.AcceptsEncodings("deflate", "identity"))
+  assert.Equal(t, "utf-8", req.AcceptsCharsets("utf-8"))
+
+  raw.Header.Set("Accept", "image/*, text/html;q=0")
+  assert.Equal(t, "", req.Accepts("html"))
+}
+
+func Test_Format_dispatches_on_the_accept_header(t *testing.T) {
+  app := Express()
+  app.Get("/user", func(req Request, res Response) {
+    res.Format(map[string]Middleware{
+      "json": func(req Request, res Response) { res.JSON(map[string]string{"name": "rob"}) },
+      "text/plain": func(req Request, res Response) { res.Write("rob") },
+    })
+  })
+  response, body := get(t, app, "/user", map[string]string{"Accept": "text/plain"})
+  assert.Equal(t, "rob", body)
+  assert.Equal(t, "Accept", response.Header.Get("Vary"))
+
+  response, body = get(t, app, "/user", map[string]string{"Accept": "application/json"})
+  assert.JSONEq(t, `{"name":"rob"}`, body)
+
+  response, _ = get(t, app, "/user", map[string]string{"Accept": "image/png"})
+  assert.Equal(t, 406, response.StatusCode)
+}
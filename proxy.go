@@ -0,0 +1,259 @@
+// Package goexpress proxy tells the client address, protocol and host
+// of a request, the Forwarded, X-Forwarded-For, X-Forwarded-Proto,
+// X-Forwarded-Host and X-Real-IP headers are only honored when the
+// immediate peer is a proxy trusted by the "trust proxy" setting
+//
+//   app.Set(SettingTrustProxy, "loopback, 10.0.0.0/8")
+//
+// Besides the addresses and CIDR ranges, the "loopback", "linklocal"
+// and "uniquelocal" names stand for the matching private ranges.
+package goexpress
+
+import (
+  "net"
+  "strings"
+)
+
+// proxyRanges are the named ranges understood by the "trust proxy" setting
+var proxyRanges = map[string][]string{
+  "loopback":    {"127.0.0.1/8", "::1/128"},
+  "linklocal":   {"169.254.0.0/16", "fe80::/10"},
+  "uniquelocal": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+}
+
+// clientInfo is the client side of a request as told by the trusted proxies
+type clientInfo struct {
+  ip       string
+  ips      []string
+  protocol string
+  host     string
+}
+
+// proxyCache is the parsed "trust proxy" setting of a settings revision
+type proxyCache struct {
+  revision uint64
+  networks []*net.IPNet
+}
+
+// trustedProxies returns the parsed "trust proxy" setting, it is only
+// parsed again once the settings changed
+func (e *express) trustedProxies() []*net.IPNet {
+  revision := e.settings.revision()
+  if cached, ok := e.proxies.Load().(*proxyCache); ok && cached.revision == revision {
+    return cached.networks
+  }
+  networks := parseTrustedProxies(e.settings)
+  e.proxies.Store(&proxyCache{revision: revision, networks: networks})
+  return networks
+}
+
+// parseTrustedProxies parses the "trust proxy" setting, the invalid
+// entries are ignored
+func parseTrustedProxies(settings *Settings) []*net.IPNet {
+  var networks []*net.IPNet
+  for _, entry := range settings.Strings(SettingTrustProxy) {
+    entry = strings.TrimSpace(entry)
+    ranges, named := proxyRanges[strings.ToLower(entry)]
+    if !named {
+      ranges = []string{entry}
+    }
+    for _, item := range ranges {
+      if !strings.Contains(item, "/") {
+        if ip := net.ParseIP(item); ip == nil {
+          continue
+        } else if ip.To4() != nil {
+          item += "/32"
+        } else {
+          item += "/128"
+        }
+      }
+      if _, network, err := net.ParseCIDR(item); err == nil {
+        networks = append(networks, network)
+      }
+    }
+  }
+  return networks
+}
+
+// isTrusted tells if an address belongs to one of the networks
+func isTrusted(networks []*net.IPNet, address string) bool {
+  ip := net.ParseIP(address)
+  if ip == nil {
+    return false
+  }
+  for _, network := range networks {
+    if network.Contains(ip) {
+      return true
+    }
+  }
+  return false
+}
+
+// stripPort returns the host of a host:port pair, brackets of the
+// IPv6 addresses removed
+func stripPort(hostport string) string {
+  if host, _, err := net.SplitHostPort(hostport); err == nil {
+    return host
+  }
+  return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+}
+
+// forwardedElement is an element of the Forwarded header
+type forwardedElement map[string]string
+
+// parseForwarded parses the RFC 7239 Forwarded header values
+func parseForwarded(values []string) []forwardedElement {
+  var elements []forwardedElement
+  for _, value := range values {
+    for _, element := range strings.Split(value, ",") {
+      var parsed = make(forwardedElement)
+      for _, pair := range strings.Split(element, ";") {
+        parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+        if len(parts) == 2 {
+          parsed[strings.ToLower(parts[0])] = strings.Trim(parts[1], `"`)
+        }
+      }
+      elements = append(elements, parsed)
+    }
+  }
+  return elements
+}
+
+// splitHeaderList returns the comma separated values of a header
+func splitHeaderList(values []string) []string {
+  var list []string
+  for _, value := range values {
+    for _, item := range strings.Split(value, ",") {
+      if item = strings.TrimSpace(item); item != "" {
+        list = append(list, item)
+      }
+    }
+  }
+  return list
+}
+
+// hopValue returns the value of a forwarded list for the hop at index
+// of a chain of the given length, every proxy appends to the lists so
+// they are aligned from the right, the last value is taken without hop
+func hopValue(list []string, length int, index int) string {
+  if len(list) == 0 {
+    return ""
+  }
+  position := len(list) - (length - index)
+  if position < 0 {
+    position = 0
+  } else if position >= len(list) {
+    position = len(list) - 1
+  }
+  return list[position]
+}
+
+// clientInfo works out the client side of the request once, the
+// protocol and the host are the ones seen by the proxy which received
+// the request from the client, the values sent before are not trusted
+func (req *request) clientInfo() *clientInfo {
+  if req.client != nil {
+    return req.client
+  }
+  var httRequest = req.ref
+  var info = &clientInfo{ip: stripPort(httRequest.RemoteAddr), protocol: "http", host: httRequest.Host}
+  if httRequest.TLS != nil {
+    info.protocol = "https"
+  }
+  req.client = info
+  networks := req.app.trustedProxies()
+  if !isTrusted(networks, info.ip) {
+    return info
+  }
+  // the chain of addresses from the client to the peer along with the
+  // protocols and hosts seen at each hop
+  var chain, protos, hosts []string
+  if elements := parseForwarded(httRequest.Header.Values("Forwarded")); len(elements) > 0 {
+    for _, element := range elements {
+      if element["for"] != "" {
+        chain = append(chain, stripPort(element["for"]))
+        protos = append(protos, element["proto"])
+        hosts = append(hosts, element["host"])
+      }
+    }
+    if len(chain) == 0 {
+      last := elements[len(elements)-1]
+      protos, hosts = []string{last["proto"]}, []string{last["host"]}
+    }
+  } else {
+    chain = splitHeaderList(httRequest.Header.Values("X-Forwarded-For"))
+    if len(chain) == 0 && httRequest.Header.Get("X-Real-IP") != "" {
+      chain = []string{strings.TrimSpace(httRequest.Header.Get("X-Real-IP"))}
+    }
+    protos = splitHeaderList(httRequest.Header.Values("X-Forwarded-Proto"))
+    hosts = splitHeaderList(httRequest.Header.Values("X-Forwarded-Host"))
+  }
+  // walk back from the peer as long as the hops are trusted
+  var index = len(chain) - 1
+  for index > 0 && isTrusted(networks, chain[index]) {
+    index--
+  }
+  if index >= 0 {
+    info.ip = chain[index]
+    info.ips = chain[index:]
+  }
+  proto, host := hopValue(protos, len(chain), index), hopValue(hosts, len(chain), index)
+  if proto != "" {
+    info.protocol = strings.ToLower(proto)
+  }
+  if host != "" {
+    info.host = host
+  }
+  return info
+}
+
+// IP returns the client address, the address the trusted proxies
+// forwarded the request for or the peer address
+func (req *request) IP() string {
+  return req.clientInfo().ip
+}
+
+// IPs returns the addresses the request went through from the client
+// to the last trusted proxy, empty when the peer is not trusted
+func (req *request) IPs() []string {
+  return req.clientInfo().ips
+}
+
+// Protocol returns "http" or "https" as seen by the client
+func (req *request) Protocol() string {
+  return req.clientInfo().protocol
+}
+
+// Secure tells if the client used https
+func (req *request) Secure() bool {
+  return req.Protocol() == "https"
+}
+
+// Hostname returns the host the client asked for, without the port
+func (req *request) Hostname() string {
+  return stripPort(req.clientInfo().host)
+}
+
+// Subdomains returns the subdomains of the hostname, the nearest to the
+// domain first, the "subdomain offset" setting is the number of the
+// labels of the domain itself, 2 by default, a negative one counts as 0
+func (req *request) Subdomains() []string {
+  hostname := req.Hostname()
+  if hostname == "" || net.ParseIP(hostname) != nil {
+    return []string{}
+  }
+  labels := strings.Split(hostname, ".")
+  offset := req.app.settings.Int(SettingSubdomainOffset)
+  if offset < 0 {
+    offset = 0
+  }
+  if offset >= len(labels) {
+    return []string{}
+  }
+  labels = labels[:len(labels)-offset]
+  subdomains := make([]string, len(labels))
+  for i, label := range labels {
+    subdomains[len(labels)-1-i] = label
+  }
+  return subdomains
+}
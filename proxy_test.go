@@ -0,0 +1,79 @@
+package goexpress
+
+import (
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_client_info_honors_only_the_trusted_proxies(t *testing.T) {
+  app := Express().(*express)
+  raw := httptest.NewRequest("GET", "http://api.eu.example.com:8080/", nil)
+  raw.RemoteAddr = "10.0.0.2:4000"
+  raw.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.1, 10.0.0.1")
+  raw.Header.Set("X-Forwarded-Proto", "https")
+  raw.Header.Set("X-Forwarded-Host", "shop.example.com")
+
+  req := newRequest(raw, app, newLocals())
+  assert.Equal(t, "10.0.0.2", req.IP())
+  assert.Empty(t, req.IPs())
+  assert.False(t, req.Secure())
+  assert.Equal(t, "api.eu.example.com", req.Hostname())
+  assert.Equal(t, []string{"eu", "api"}, req.Subdomains())
+
+  app.Set(SettingTrustProxy, "uniquelocal")
+  req = newRequest(raw, app, newLocals())
+  assert.Equal(t, "198.51.100.1", req.IP())
+  assert.Equal(t, []string{"198.51.100.1", "10.0.0.1"}, req.IPs())
+  assert.Equal(t, "https", req.Protocol())
+  assert.Equal(t, "shop.example.com", req.Hostname())
+  assert.Equal(t, []string{"shop"}, req.Subdomains())
+
+  raw.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=http, for=10.0.0.1`)
+  req = newRequest(raw, app, newLocals())
+  assert.Equal(t, "2001:db8::1", req.IP())
+  assert.Equal(t, "http", req.Protocol())
+}
+
+func Test_Subdomains_takes_a_negative_offset_as_zero(t *testing.T) {
+  app := Express().(*express)
+  raw := httptest.NewRequest("GET", "http://api.eu.example.com/", nil)
+
+  app.Set(SettingSubdomainOffset, -1)
+  req := newRequest(raw, app, newLocals())
+  assert.Equal(t, []string{"com", "example", "eu", "api"}, req.Subdomains())
+
+  app.Set(SettingSubdomainOffset, 3)
+  req = newRequest(raw, app, newLocals())
+  assert.Equal(t, []string{"api"}, req.Subdomains())
+}
+
+func Test_client_info_takes_proto_and_host_from_the_trusted_hop(t *testing.T) {
+  app := Express().(*express)
+  app.Set(SettingTrustProxy, "uniquelocal")
+  raw := httptest.NewRequest("GET", "http://api.example.com/", nil)
+  raw.RemoteAddr = "10.0.0.2:4000"
+  // the first element is made up by the client
+  raw.Header.Set("Forwarded", `for=1.2.3.4;proto=https;host=evil.com, for=203.0.113.9;proto=http;host=shop.example.com`)
+  req := newRequest(raw, app, newLocals())
+  assert.Equal(t, "203.0.113.9", req.IP())
+  assert.False(t, req.Secure())
+  assert.Equal(t, "shop.example.com", req.Hostname())
+
+  raw.Header.Del("Forwarded")
+  raw.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.9")
+  raw.Header.Set("X-Forwarded-Proto", "https, http")
+  raw.Header.Set("X-Forwarded-Host", "evil.com, shop.example.com")
+  req = newRequest(raw, app, newLocals())
+  assert.Equal(t, "203.0.113.9", req.IP())
+  assert.Equal(t, "http", req.Protocol())
+  assert.Equal(t, "shop.example.com", req.Hostname())
+
+  // the setting is parsed again once changed
+  networks := app.trustedProxies()
+  assert.Equal(t, &networks[0], &app.trustedProxies()[0])
+  app.Set(SettingTrustProxy, "loopback")
+  req = newRequest(raw, app, newLocals())
+  assert.Equal(t, "10.0.0.2", req.IP())
+}
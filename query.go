@@ -0,0 +1,197 @@
+// Package goexpress query parses the bracketed query and form keys into
+// a tree of nested values the way the qs module of node does
+//
+//   filter[status]=open&filter[tags][]=a&filter[tags][]=b&sort[]=-created
+//
+// is read as
+//
+//   {"filter": {"status": "open", "tags": ["a", "b"]}, "sort": ["-created"]}
+//
+// The leaves are strings, the lists []interface{} and the objects
+// map[string]interface{}, an object with only numeric keys like
+// ids[0]=a&ids[1]=b is a list ordered by the keys. A repeated plain key
+// is a list as well. Request.Bind reads the nested `query` and `form`
+// values into the struct and map fields.
+package goexpress
+
+import (
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// QueryTree returns the query string parsed into a tree, a 400
+// HTTPError is returned when the query goes over the MaxParams or
+// MaxDepth limits
+func (req *request) QueryTree() (map[string]interface{}, error) {
+  if req.queryTree == nil {
+    var count = 0
+    for _, values := range req.query {
+      count += len(values)
+    }
+    if req.limits.MaxParams > 0 && count > req.limits.MaxParams {
+      return nil, NewHTTPError(400, "Too many query parameters")
+    }
+    tree, err := parseNested(req.query, req.limits.MaxDepth)
+    if err != nil {
+      return nil, err
+    }
+    req.queryTree = tree
+  }
+  return req.queryTree, nil
+}
+
+// BodyTree returns the urlencoded or multipart form values parsed into
+// a tree, see QueryTree
+func (req *request) BodyTree() (map[string]interface{}, error) {
+  if err := req.ParseBody(); err != nil {
+    return nil, err
+  }
+  if req.bodyTree == nil {
+    tree, err := parseNested(req.body, req.limits.MaxDepth)
+    if err != nil {
+      return nil, err
+    }
+    req.bodyTree = tree
+  }
+  return req.bodyTree, nil
+}
+
+// parseNested builds the tree of the bracketed keys, a key nested
+// deeper than maxDepth is rejected, zero means no limit
+func parseNested(values map[string][]string, maxDepth int) (map[string]interface{}, error) {
+  // sorted so the numeric keys and the conflicts resolve the same way
+  keys := make([]string, 0, len(values))
+  for key := range values {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  var tree = make(map[string]interface{})
+  for _, key := range keys {
+    segments := splitNestedKey(key)
+    if maxDepth > 0 && len(segments)-1 > maxDepth {
+      return nil, NewHTTPError(400, "Parameter "+key+" is nested too deep")
+    }
+    for _, value := range values[key] {
+      insertNested(tree, segments, value)
+    }
+  }
+  for key, node := range tree {
+    tree[key] = compactNested(node)
+  }
+  return tree, nil
+}
+
+// splitNestedKey splits a[b][] into a, b and "", a key which is not
+// well bracketed is kept as is
+func splitNestedKey(key string) []string {
+  open := strings.IndexByte(key, '[')
+  if open <= 0 || !strings.HasSuffix(key, "]") {
+    return []string{key}
+  }
+  var segments = []string{key[:open]}
+  for rest := key[open:]; rest != ""; {
+    end := strings.IndexByte(rest, ']')
+    if rest[0] != '[' || end == -1 {
+      return []string{key}
+    }
+    segments = append(segments, rest[1:end])
+    rest = rest[end+1:]
+  }
+  return segments
+}
+
+// insertNested sets a value at the path of the segments, an empty
+// segment appends to a list, the values conflicting with an existing
+// node of another kind are dropped
+func insertNested(node map[string]interface{}, segments []string, value string) {
+  key := segments[0]
+  if len(segments) == 1 {
+    switch existing := node[key].(type) {
+    case nil:
+      node[key] = value
+    case string:
+      node[key] = []interface{}{existing, value}
+    case []interface{}:
+      node[key] = append(existing, value)
+    }
+    return
+  }
+  if segments[1] == "" {
+    list, isList := node[key].([]interface{})
+    if !isList && node[key] != nil {
+      if leaf, isLeaf := node[key].(string); isLeaf {
+        list = []interface{}{leaf}
+      } else {
+        return
+      }
+    }
+    if len(segments) == 2 {
+      node[key] = append(list, value)
+      return
+    }
+    // a[][b]=1 appends a new object
+    child := make(map[string]interface{})
+    insertNested(child, segments[2:], value)
+    node[key] = append(list, child)
+    return
+  }
+  if node[key] == nil {
+    node[key] = make(map[string]interface{})
+  }
+  if child, isMap := node[key].(map[string]interface{}); isMap {
+    insertNested(child, segments[1:], value)
+  }
+}
+
+// compactNested turns the objects with only numeric keys into lists
+// ordered by the keys, the indexes are not used as positions so a
+// huge index does not allocate a huge list
+func compactNested(node interface{}) interface{} {
+  switch value := node.(type) {
+  case []interface{}:
+    for i, item := range value {
+      value[i] = compactNested(item)
+    }
+  case map[string]interface{}:
+    var indexes = make([]int, 0, len(value))
+    var numeric = len(value) > 0
+    for key, item := range value {
+      value[key] = compactNested(item)
+      if index, err := strconv.Atoi(key); err == nil && index >= 0 && strconv.Itoa(index) == key {
+        indexes = append(indexes, index)
+      } else {
+        numeric = false
+      }
+    }
+    if !numeric {
+      return value
+    }
+    sort.Ints(indexes)
+    list := make([]interface{}, len(indexes))
+    for i, index := range indexes {
+      list[i] = value[strconv.Itoa(index)]
+    }
+    return list
+  }
+  return node
+}
+
+// nestedValues returns the strings of a leaf or a list of leaves
+func nestedValues(node interface{}) ([]string, bool) {
+  switch value := node.(type) {
+  case string:
+    return []string{value}, true
+  case []interface{}:
+    var list = make([]string, 0, len(value))
+    for _, item := range value {
+      leaf, isLeaf := item.(string)
+      if !isLeaf {
+        return nil, false
+      }
+      list = append(list, leaf)
+    }
+    return list, true
+  }
+  return nil, false
+}
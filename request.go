@@ -4,106 +4,189 @@
 package goexpress
 
 import (
+  "bytes"
   "encoding/json"
+  "errors"
   "io"
-  "log"
   "mime/multipart"
   "net/http"
   "net/textproto"
   "net/url"
-  "strconv"
   "strings"
 )
 
-// EntrySet defines a map entry set
-type EntrySet struct {
-  keys map[string]string
-}
-
-// Get returns a value from the entry set
-func (e *EntrySet) Get(key string) string {
-  return e.keys[key]
+// File contains the reader to read the buffer content of
+// uploading file, File is set for the buffered uploads of Files
+// and Reader for the streamed ones of NextPart
+type File struct {
+  Name        string
+  FormName    string
+  Mime        textproto.MIMEHeader
+  File        multipart.File
+  Reader      *multipart.Part
+  Size        int64     // size of the buffered uploads
+  ContentType string    // media type sniffed from the content
+  SHA256      string    // hex digest of the content set by SaveTo
+  reader      io.Reader // sniffed and size limited stream of Reader
 }
 
-// Set a value to the entry set
-func (e *EntrySet) Set(key string, v string) {
-  e.keys[key] = v
+// Read reads the file content in both buffered and streamed mode
+func (f *File) Read(p []byte) (int, error) {
+  if f.File != nil {
+    return f.File.Read(p)
+  } else if f.reader != nil {
+    return f.reader.Read(p)
+  }
+  return f.Reader.Read(p)
 }
 
-// File contains the reader to read the buffer content of
-// uploading file
-type File struct {
-  Name     string
-  FormName string
-  Mime     textproto.MIMEHeader
-  File     multipart.File
-  Reader   *multipart.Part
-}
+// ErrBodyConsumed is returned when the body was already read in another mode
+var ErrBodyConsumed = errors.New("goexpress: the request body was already read")
 
 // Request Structure
 type request struct {
   ref        *http.Request
   fileReader *multipart.Reader
-  header     *EntrySet
+  header     *HeaderSet
   files      []*File
   method     string
   url        string
   _url       *url.URL
   params     *EntrySet // a map to be filled by router
   query      map[string][]string
+  queryTree  map[string]interface{} // nested query, see QueryTree
   body       map[string][]string
+  bodyTree   map[string]interface{} // nested form, see BodyTree
   cookies    *cookie
   json       *json.Decoder
-  props      *map[string]interface{}
+  app        *express
+  mediaType  string            // lowercased content-type without params
+  mimeParams map[string]string // content-type params like charset
+  parser     BodyParser        // registered parser of the media type
+  parserType string            // media type the parser was registered for
+  bodyParsed bool              // ParseBody was called
+  bodyError  error             // failure while parsing the body
+  rawBody    []byte            // body as sent, see RawBody
+  limits     Limits            // body limits, see WithLimits
+  fieldCount int               // form values read against the limits
+  formSize   int64             // size of the form values read against the limits
+  fileCount  int               // files read against the limits
+  tempFiles  []string          // uploads spilled to the disk
+  client     *clientInfo       // client side as told by the trusted proxies
+  response   *response         // response being sent, set by express
+  id         string            // request identifier, see ID
+  locals     *Locals
+  next       func() // continues the handler chain, set by express
 }
 
 // MaxBufferSize is a const type
 const MaxBufferSize int64 = 1024 * 1024
 
 // newRequest creates a new request struct for express
-func newRequest(httRequest *http.Request, props *map[string]interface{}) *request {
+// The body is left untouched until it is first used, see ParseBody
+func newRequest(httRequest *http.Request, app *express, locals *Locals) *request {
   req := &request{}
-  req.header = &EntrySet{keys: make(map[string]string)}
+  req.header = newHeaderSet(httRequest.Header)
   req.body = make(map[string][]string)
   req.files = make([]*File, 0)
-  req.body = httRequest.Form
   req.ref = httRequest
   req.cookies = newReadOnlyCookie(httRequest)
   req.query = make(map[string][]string)
   req.query = httRequest.URL.Query()
   req.method = strings.ToLower(httRequest.Method)
   req.url = httRequest.URL.Path
-  req.params = &EntrySet{keys: make(map[string]string)}
+  req.params = newEntrySet()
   req._url = httRequest.URL
-  req.props = props
+  req.app = app
+  req.locals = locals
+  req.limits = app.limits
   req.fileReader = nil
-  for key, value := range httRequest.Header {
-    // lowercase the header key names
-    req.header.Set(strings.ToLower(key), strings.Join(value, ","))
-  }
+  req.mediaType, req.mimeParams = parseMediaType(req.header.Get("content-type"))
+  req.parser, req.parserType = app.parsers.lookup(req.mediaType)
+  req.id = req.requestID()
+  return req
+}
 
-  if req.header.Get("content-type") == "application/json" {
+// ParseBody reads the body as per its media type, it is called on the
+// first use of Body, Files, JSON, Decode or Bind so a middleware can
+// reject a request before any of the body is read
+// JSON and the bodies with a registered parser are decoded on demand,
+// the urlencoded and multipart forms are read at once
+func (req *request) ParseBody() error {
+  if req.bodyParsed {
+    return req.bodyError
+  }
+  if err := req.openBody(); err != nil {
+    return err
+  }
+  var httRequest = req.ref
+  if req.IsJSON() {
+    // read by JSON, or by the parser registered in place of JSONParser
     req.json = json.NewDecoder(httRequest.Body)
+  } else if req.parser != nil {
+    // decoded on demand by Decode or Bind
+  } else if boundary := req.mimeParams["boundary"]; strings.HasPrefix(req.mediaType, "multipart/") && boundary != "" {
+    // a form-data request
+    req.bodyError = req.ReadMultiPartBody(boundary, 0)
+  } else if err := httRequest.ParseForm(); err != nil {
+    req.bodyError = bodyError(err, "Invalid form body")
   } else {
-    httRequest.ParseForm()
+    for key, value := range httRequest.PostForm {
+      req.fieldCount += len(value)
+      req.body[key] = value
+    }
+    if req.limits.MaxFields > 0 && req.fieldCount > req.limits.MaxFields {
+      req.bodyError = NewHTTPError(413, "Too many form fields")
+    }
+  }
+  return req.bodyError
+}
+
+// RawBody returns the body exactly as sent, it is buffered up to the
+// MaxRawBodySize limit on the first call and the parsed views of the
+// body like JSON, Body or Bind still read it afterwards
+// Once the body is parsed it fails with ErrBodyConsumed unless RawBody
+// was called before, see PreserveRawBody
+func (req *request) RawBody() ([]byte, error) {
+  if req.rawBody != nil {
+    return req.rawBody, nil
   }
-  // check if we have an anonymous form posted
-  if len(httRequest.PostForm) > 0 && len(req.body) == 0 {
-    req.body = make(map[string][]string)
+  if req.bodyParsed {
+    return nil, ErrBodyConsumed
   }
-  for key, value := range httRequest.PostForm {
-    req.body[key] = value
+  var max = req.limits.MaxRawBodySize
+  if max == 0 {
+    max = MaxBufferSize
   }
-  // check whether the request is a form-data request
-  var boundary string
-  if req.IsMultipart(req.header.Get("content-type"), &boundary) {
-    var bufferSize int
-    if req.header.Get("content-length") != "" {
-      bufferSize, _ = strconv.Atoi(req.header.Get("content-length"))
+  var httRequest = req.ref
+  var body io.Reader = httRequest.Body
+  if max > 0 {
+    if httRequest.ContentLength > max {
+      return nil, NewHTTPError(413, "Request body is too large")
+    }
+    body = newLimitedReader(body, max, NewHTTPError(413, "Request body is too large"))
+  }
+  raw, err := io.ReadAll(body)
+  if err != nil {
+    // the body is partly read, nothing else can parse it
+    req.bodyParsed = true
+    req.bodyError = bodyError(err, "Invalid request body")
+    return nil, req.bodyError
+  }
+  req.rawBody = append([]byte{}, raw...)
+  httRequest.Body = &wrappedBody{Reader: bytes.NewReader(req.rawBody), Closer: httRequest.Body}
+  return req.rawBody, nil
+}
+
+// PreserveRawBody returns a middleware buffering the body of the
+// requests it handles, so RawBody is available along with the parsed
+// views of the body, i.e. to verify a webhook signature after Bind
+func PreserveRawBody() Middleware {
+  return func(req Request, res Response) {
+    if _, err := req.RawBody(); err != nil {
+      res.Fail(err)
     }
-    req.ReadMultiPartBody(boundary, int64(bufferSize))
   }
-  return req
 }
 
 // IsMultipart return whether the request has a multipart form attached to it
@@ -119,43 +202,6 @@ func (req *request) IsMultipart(header string, boundary *string) bool {
   return false
 }
 
-// ReadMultiPartBody reads a multipart form and populate the same in req params
-func (req *request) ReadMultiPartBody(boundary string, bufferSize int64) {
-  var size = MaxBufferSize
-  if bufferSize != 0 {
-    size = bufferSize
-  }
-  reader := multipart.NewReader(req.ref.Body, boundary)
-  form, err := reader.ReadForm(size)
-  if err != nil {
-    return
-  }
-  if req.body == nil {
-    req.body = make(map[string][]string)
-  }
-  // read all the keys values and append to body
-  for key, value := range form.Value {
-    req.body[key] = value
-  }
-  // get the references to all the file params
-  for formName, files := range form.File {
-    for _, file := range files {
-      fileStruct := &File{FormName: formName, Name: file.Filename, Mime: file.Header}
-      f, err := file.Open()
-      if err == nil {
-        fileStruct.File = f
-        req.files = append(req.files, fileStruct)
-      } else {
-        log.Panic("Failed to open uploaded file reader: %s", err.Error())
-      }
-    }
-  }
-}
-
-// todo: Parser for Array and interface
-// func (req *Request) parseQuery(){
-//   req._url.RawQuery
-
 // GetURL returns the URL structure
 func (req *request) URL() *url.URL {
   return req._url
@@ -166,25 +212,58 @@ func (req *request) GetRaw() *http.Request {
   return req.ref
 }
 
-// GetFile returns a file struct to read in case of file upload request
-func (req *request) getFile() *File {
+// NextPart returns the next file of a multipart body straight from the
+// connection without buffering it, the form values met on the way are
+// added to Body and io.EOF is returned after the last file
+// Streaming and the buffered Files are mutually exclusive, Files is
+// empty once NextPart is called and NextPart fails once the body is parsed
+func (req *request) NextPart() (*File, error) {
   if req.fileReader == nil {
-    reader, err := req.ref.MultipartReader()
-    if err != nil {
-      log.Panicf("Couldn't get the reader attached, error: %v", err)
+    if req.bodyParsed {
+      return nil, ErrBodyConsumed
+    }
+    boundary := req.mimeParams["boundary"]
+    if !strings.HasPrefix(req.mediaType, "multipart/") || boundary == "" {
+      return nil, NewHTTPError(415, "Expected a multipart body")
+    }
+    if err := req.openBody(); err != nil {
+      return nil, err
     }
-    req.fileReader = reader
+    req.fileReader = multipart.NewReader(req.ref.Body, boundary)
   }
+  for {
+    part, err := req.fileReader.NextPart()
+    if err == io.EOF {
+      return nil, io.EOF
+    } else if err != nil {
+      return nil, bodyError(err, "Invalid multipart body")
+    }
+    if part.FileName() == "" {
+      // a form value, keep it around for Body
+      if err = req.readFormValue(part); err != nil {
+        return nil, err
+      }
+      continue
+    }
+    return req.newUploadedFile(part)
+  }
+}
 
-  part, err := req.fileReader.NextPart()
-  if err == io.EOF || part == nil {
-    return nil
+// EachFile streams every file of a multipart body to the callback, the
+// file can only be read until the callback returns and an error returned
+// by the callback stops the iteration, see NextPart
+func (req *request) EachFile(callback func(file *File) error) error {
+  for {
+    file, err := req.NextPart()
+    if err == io.EOF {
+      return nil
+    } else if err != nil {
+      return err
+    }
+    if err = callback(file); err != nil {
+      return err
+    }
   }
-  var file = &File{}
-  file.Name = part.FileName()
-  file.FormName = part.FormName()
-  file.Reader = part
-  return file
 }
 
 // Cookie returns the cookie struct associated with the request
@@ -203,12 +282,23 @@ func (req *request) Params() *EntrySet {
 }
 
 // Header returns header set
-func (req *request) Header() *EntrySet {
+func (req *request) Header() *HeaderSet {
   return req.header
 }
 
-// Body returns value of a form element
+// parseBodyOrFail parses the body for the accessors which can not
+// return an error, a failure like a breached limit is answered through
+// the app error handlers, see ParseBody for handling it in place
+func (req *request) parseBodyOrFail() {
+  if err := req.ParseBody(); err != nil && req.response != nil && !req.response.HasEnded() {
+    req.response.Fail(err)
+  }
+}
+
+// Body returns value of a form element, a body which can not be read
+// is answered with its HTTPError and nothing is returned
 func (req *request) Body(key string) []string {
+  req.parseBodyOrFail()
   return req.body[key]
 }
 
@@ -217,17 +307,52 @@ func (req *request) Query(key string) []string {
   return req.query[key]
 }
 
-// JSON returns a request's json decoder
+// JSON returns a request's json decoder, see Body for the failures,
+// the errors met while decoding are returned by the decoder
 func (req *request) JSON() *json.Decoder {
+  req.parseBodyOrFail()
   return req.json
 }
 
+// Decode decodes the body into v with the parser of the request media
+// type, a 415 HTTPError is returned if the media type has no parser
+func (req *request) Decode(v interface{}) error {
+  if err := req.ParseBody(); err != nil {
+    return err
+  }
+  var err error
+  if req.decodesJSON() {
+    err = req.json.Decode(v)
+  } else if req.parser != nil {
+    err = req.parser.Decode(req.ref.Body, v)
+  } else {
+    return NewHTTPError(415, "Unsupported media type "+req.mediaType)
+  }
+  if err != nil {
+    return bodyError(err, "Invalid request body")
+  }
+  return nil
+}
+
 // IsJSON tells if the sent request is a json body
 func (req *request) IsJSON() bool {
-  return req.json != nil
+  return req.parserType == jsonMediaType
 }
 
-// Files returns all the attached files with the request
+// decodesJSON tells if the body is decoded by the JSON decoder, which
+// is the case unless a parser replaced JSONParser for the json types
+func (req *request) decodesJSON() bool {
+  return req.IsJSON() && req.parser == JSONParser
+}
+
+// Files returns all the attached files with the request, see Body for
+// the failures
 func (req *request) Files() []*File {
+  req.parseBodyOrFail()
   return req.files
 }
+
+// Locals returns the per-request store shared with the response
+func (req *request) Locals() *Locals {
+  return req.locals
+}
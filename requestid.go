@@ -0,0 +1,56 @@
+// Package goexpress requestid tags every request with an identifier
+//
+// The identifier sent by the client or a proxy in the "request id
+// header" setting header, X-Request-ID by default, is kept when it is
+// valid, otherwise a random UUID is generated. It is echoed back on the
+// response, prefixes the framework logs and is part of the default
+// error pages, so a client report can be matched with the server logs.
+package goexpress
+
+import (
+  "crypto/rand"
+  "fmt"
+)
+
+// maxRequestIDLength bounds the identifiers accepted from the clients
+const maxRequestIDLength = 200
+
+// validRequestID tells if an incoming identifier is safe to be logged
+// and echoed, only printable ASCII is accepted
+func validRequestID(id string) bool {
+  if id == "" || len(id) > maxRequestIDLength {
+    return false
+  }
+  for i := 0; i < len(id); i++ {
+    if id[i] < 0x21 || id[i] > 0x7E {
+      return false
+    }
+  }
+  return true
+}
+
+// newRequestID returns a random version 4 UUID
+func newRequestID() string {
+  var uuid [16]byte
+  if _, err := rand.Read(uuid[:]); err != nil {
+    panic("goexpress: no randomness available: " + err.Error())
+  }
+  uuid[6] = uuid[6]&0x0F | 0x40
+  uuid[8] = uuid[8]&0x3F | 0x80
+  return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// requestID returns the identifier of the incoming request
+func (req *request) requestID() string {
+  if name := req.app.settings.String(SettingRequestIDHeader); name != "" {
+    if id := req.ref.Header.Get(name); validRequestID(id) {
+      return id
+    }
+  }
+  return newRequestID()
+}
+
+// ID returns the identifier of the request
+func (req *request) ID() string {
+  return req.id
+}
@@ -14,7 +14,10 @@ import (
   "log"
   "net"
   "net/http"
+  "path/filepath"
   "strconv"
+  "strings"
+  "sync"
   "time"
 
   utils "github.com/DronRathore/go-mimes"
@@ -30,28 +33,34 @@ type response struct {
   response   http.ResponseWriter
   header     *header
   cookie     *cookie
-  Locals     map[string]interface{}
+  locals     *Locals
+  fail       func(error) // error chain of the app, set by express
+  request    *request    // request being answered, set by express
   writer     *bufio.ReadWriter
   connection net.Conn
   ended      bool
-  props      *map[string]interface{}
+  body       *BodyWriter   // buffered body writer, see Writer
+  closeOnce  sync.Once     // starts the disconnect detection once
+  closed     chan struct{} // closed once the client went away
+  stream     *EventStream  // event stream stopped once the response ends
+  settings   *Settings
   url        string
   method     string
 }
 
 // newResponse creates a new Response Struct, requires the Hijacked buffer,
 // connection and Response interface
-func newResponse(rs http.ResponseWriter, r *http.Request, w *bufio.ReadWriter, con net.Conn, props *map[string]interface{}) *response {
+func newResponse(rs http.ResponseWriter, r *http.Request, w *bufio.ReadWriter, con net.Conn, settings *Settings, locals *Locals) *response {
   res := &response{}
   res.response = rs
   res.writer = w
   res.connection = con
   res.header = newHeader(rs, r, w)
   res.cookie = newCookie(res, r)
-  res.Locals = make(map[string]interface{})
+  res.locals = locals
   res.url = r.URL.Path
   res.ended = false
-  res.props = props
+  res.settings = settings
   res.method = r.Method
   return res
 }
@@ -66,7 +75,7 @@ func (res *response) Write(content string) Response {
   if res.header.BasicSent() == false && res.header.CanSendHeader() == true {
     res.cookie.Finish()
     if sent := res.header.FlushHeaders(); sent == false {
-      log.Print("Failed to push headers")
+      log.Printf("[%s] Failed to push headers", res.requestID())
     }
   }
   var bytes = []byte(content)
@@ -80,6 +89,10 @@ func (res *response) WriteBytes(bytes []byte) error {
   if res.header.BasicSent() == false && res.header.CanSendHeader() {
     res.header.FlushHeaders()
   }
+  if len(bytes) == 0 || res.header.chunked == false {
+    // an empty chunk would end the body
+    return nil
+  }
 
   var chunkSize = fmt.Sprintf("%x", len(bytes))
   _, err := res.writer.Write([]byte(chunkSize + _endline))
@@ -99,17 +112,30 @@ func (res *response) WriteBytes(bytes []byte) error {
   return res.writer.Flush()
 }
 
+// sendContent sends the whole body and ends the response, the status
+// is used unless one was set with Status and the body is dropped for
+// the statuses which can not have one
 func (res *response) sendContent(status int, contentType string, content []byte) {
   defer res.End()
 
   if res.header.BasicSent() == false {
-    res.header.SetStatus(status)
+    if res.header.StatusCode == 0 {
+      res.header.SetStatus(status)
+    }
+    if bodilessStatus(res.header.StatusCode) {
+      res.header.Del("Content-Type")
+      return
+    }
+    if (res.header.Get("ETag") != "" || res.header.Get("Last-Modified") != "") && res.request != nil && res.request.Fresh() {
+      res.sendNotModified()
+      return
+    }
   }
   if res.header.CanSendHeader() == true {
     res.header.Set("Content-Type", contentType)
     res.cookie.Finish()
     if sent := res.header.FlushHeaders(); sent == false {
-      log.Print("Failed to write headers")
+      log.Printf("[%s] Failed to write headers", res.requestID())
       return
     }
   }
@@ -132,84 +158,49 @@ func (res *response) SendFile(url string, noCache bool) bool {
   file, err := newFile(url, 0)
   if err != nil {
     // panic and return false
-    log.Print("File not found ", url, err)
+    log.Printf("[%s] File not found %s %v", res.requestID(), url, err)
     res.header.SetStatus(404)
     res.header.FlushHeaders()
     res.End()
     return false
   }
+  defer file.f.Close()
   stat, err := file.Stat()
   if err != nil {
-    log.Print("Couldn't get fstat of ", url)
+    log.Printf("[%s] Couldn't get fstat of %s", res.requestID(), url)
     return false
   }
   if stat.IsDir() == true {
     // cannot send dir, abort
     return false
   }
-  // get file properties
-  var modTime = stat.ModTime().Unix()
-  var currTime = (time.Now()).Format(time.RFC1123)
-  var etag = res.header.GetRequestHeader("If-None-Match")
   // set the content-type
   var ext = utils.GetMimeType(url)
-  if res.header.CanSendHeader() {
-    if ext == "" {
-      res.header.Set("Content-Type", "none")
-    } else {
-      res.header.Set("Content-Type", ext)
-    }
+  if res.header.CanSendHeader() == false {
+    res.End()
+    log.Printf("[%s] Cannot write header after being flushed", res.requestID())
+    return false
+  }
+  if ext == "" {
+    res.header.Set("Content-Type", "none")
+  } else {
+    res.header.Set("Content-Type", ext)
   }
   if noCache == false {
     hasher := md5.New()
-    io.WriteString(hasher, strconv.FormatInt(modTime, 10))
-    hash := hex.EncodeToString(hasher.Sum(nil))
-    var miss = true
-    // do we have an etag
-    if len(etag) == 1 {
-      if etag[0] == hash {
-        // its a hit!
-        if res.header.CanSendHeader() == true {
-          res.header.SetStatus(304)
-          res.header.Set("Cache-Control", "max-age=300000")
-          miss = false
-        } else {
-          res.End()
-          log.Print("Cannot write header after being sent")
-          return false
-        }
-      } // a miss
-    }
-
-    if miss == true {
-      if res.header.CanSendHeader() == true {
-        res.header.Set("Etag", hash)
-      } else {
-        res.End()
-        log.Print("Cannot write header after being flushed")
-        return false
-      }
-    }
-    // set the date
-    if res.header.CanSendHeader() == true {
-      res.header.Set("Date", currTime)
-      res.cookie.Finish()
-      res.header.FlushHeaders()
-    } else {
-      res.End()
-      log.Print("Cannot write header after being flushed")
-      return false
-    }
-
-    if miss == false {
-      // empty response for cache hit
-      res.End()
+    io.WriteString(hasher, strconv.FormatInt(stat.ModTime().Unix(), 10))
+    res.header.Set("ETag", "\""+hex.EncodeToString(hasher.Sum(nil))+"\"")
+    res.header.Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+    res.header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+    if res.request != nil && res.request.Fresh() {
+      // its a hit, empty response
+      res.header.Set("Cache-Control", "max-age=300000")
+      res.sendNotModified()
       return true
     }
-  } else {
-    res.cookie.Finish()
-    res.header.FlushHeaders()
   }
+  res.cookie.Finish()
+  res.header.FlushHeaders()
 
   _, err = file.Pipe(res)
   if err != nil {
@@ -225,7 +216,7 @@ func (res *response) Download(path string, fileName string) bool {
     res.header.Set("Content-Disposition", "attachment; filename=\""+fileName+"\"")
     return res.SendFile(path, false)
   }
-  log.Print("Cannot Send header after being flushed")
+  log.Printf("[%s] Cannot Send header after being flushed", res.requestID())
   res.End()
   return false
 
@@ -233,33 +224,55 @@ func (res *response) Download(path string, fileName string) bool {
 
 // End a response and drops the connection with client
 func (res *response) End() {
-  res.ended = true
-  _, err := res.writer.WriteString("0\r\n\r\n")
-  if err != nil {
-    log.Panicf("Failed to write response, error : %v", err)
+  if res.ended {
     return
   }
-  err = res.writer.Flush()
-  if err != nil {
-    log.Panicf("Failed to write response, error : %v", err)
+  if res.stream != nil {
+    // no heartbeat after the last chunk
+    res.stream.stop()
+  }
+  if res.body != nil {
+    // whatever is left in the body writer
+    res.body.Flush()
+  }
+  res.ended = true
+  // a response without any body still needs its headers
+  if res.header.BasicSent() == false {
+    res.cookie.Finish()
+    res.header.FlushHeaders()
+  }
+  if res.header.chunked {
+    // the last chunk
+    res.writer.WriteString("0\r\n\r\n")
+  }
+  if err := res.writer.Flush(); err != nil {
+    // the client went away, nothing left to do but closing
+    log.Printf("[%s] Failed to write response, error : %v", res.requestID(), err)
+    res.connection.Close()
     return
   }
 
-  err = res.connection.Close()
-  if err != nil {
-    log.Print("Couldn't close the connection, already lost?")
-  } else if (*res.props)["log"] == true {
-    log.Print(res.method, " ", res.url, " ", res.header.StatusCode)
+  if err := res.connection.Close(); err != nil {
+    log.Printf("[%s] Couldn't close the connection, already lost?", res.requestID())
+  } else if res.settings.Bool(SettingLog) {
+    log.Printf("[%s] %s %s %d", res.requestID(), res.method, res.url, res.header.StatusCode)
   }
 }
 
+// requestID returns the id of the request served, prefixing the logs
+func (res *response) requestID() string {
+  if res.request == nil {
+    return ""
+  }
+  return res.request.id
+}
+
 // Redirect a request, takes the url as the Location
 func (res *response) Redirect(url string) Response {
   res.header.SetStatus(302)
   res.header.Set("Location", url)
   res.cookie.Finish()
   res.header.FlushHeaders()
-  res.ended = true
   res.End()
   return res
 }
@@ -284,22 +297,131 @@ func (res *response) GetBuffer() *bufio.ReadWriter {
   return res.writer
 }
 
-// Send Error, takes HTTP status and a string content
+// Error sends a HTTPError with the status and the message
 func (res *response) Error(status int, str string) {
-  res.sendContent(status, "text/html", []byte(str))
-  log.Panic(str)
+  res.Fail(NewHTTPError(status, str))
+}
+
+// Fail passes the error to the app error handlers, a HTTPError is
+// answered with its status and any other error with a 500
+func (res *response) Fail(err error) {
+  if res.fail != nil {
+    res.fail(err)
+    return
+  }
+  res.sendErrorPage(toHTTPError(err))
 }
 
 // JSON send JSON response, takes interface as input
+// The output is indented as per the "json spaces" setting
 func (res *response) JSON(content interface{}) {
-  output, err := json.Marshal(content)
+  var output []byte
+  var err error
+  if spaces := res.settings.Int(SettingJSONSpaces); spaces > 0 {
+    output, err = json.MarshalIndent(content, "", strings.Repeat(" ", spaces))
+  } else {
+    output, err = json.Marshal(content)
+  }
   if err != nil {
+    res.header.SetStatus(500)
     res.sendContent(500, "application/json", []byte(""))
   } else {
     res.sendContent(200, "application/json", output)
   }
 }
 
+// Status sets the response status, chain it with a method sending
+// the body
+//
+//   res.Status(201).JSON(user)
+func (res *response) Status(code int) Response {
+  res.header.SetStatus(code)
+  return res
+}
+
+// Send sends a body picking the content type from its value unless
+// the Content-Type header is set, strings are sent as HTML, []byte as
+// binary, an io.Reader is streamed and any other value as JSON
+func (res *response) Send(body interface{}) {
+  var contentType = res.header.Get("Content-Type")
+  switch value := body.(type) {
+  case nil:
+    res.sendContent(200, contentType, nil)
+  case string:
+    if contentType == "" {
+      contentType = "text/html;charset=utf-8"
+    }
+    res.sendContent(200, contentType, []byte(value))
+  case []byte:
+    if contentType == "" {
+      contentType = "application/octet-stream"
+    }
+    res.sendContent(200, contentType, value)
+  case io.Reader:
+    if contentType == "" {
+      contentType = "application/octet-stream"
+    }
+    res.sendReader(contentType, value)
+  default:
+    res.JSON(value)
+  }
+}
+
+// sendReader streams a reader as the body and ends the response
+func (res *response) sendReader(contentType string, reader io.Reader) {
+  defer res.End()
+  if closer, ok := reader.(io.Closer); ok {
+    defer closer.Close()
+  }
+  if res.header.BasicSent() == false {
+    if bodilessStatus(res.header.StatusCode) {
+      res.header.Del("Content-Type")
+      return
+    }
+    res.header.Set("Content-Type", contentType)
+    res.cookie.Finish()
+    res.header.FlushHeaders()
+  }
+  var buffer = make([]byte, 32*1024)
+  for {
+    n, err := reader.Read(buffer)
+    if n > 0 {
+      if writeErr := res.WriteBytes(buffer[:n]); writeErr != nil {
+        log.Printf("[%s] Failed to stream the response %v", res.requestID(), writeErr)
+        return
+      }
+    }
+    if err == io.EOF {
+      return
+    } else if err != nil {
+      log.Printf("[%s] Failed to read the response body %v", res.requestID(), err)
+      return
+    }
+  }
+}
+
+// Text sends a plain text body
+func (res *response) Text(body string) {
+  res.sendContent(200, "text/plain;charset=utf-8", []byte(body))
+}
+
+// HTML sends a HTML body
+func (res *response) HTML(body string) {
+  res.sendContent(200, "text/html;charset=utf-8", []byte(body))
+}
+
+// SendStatus sends the status with its reason phrase as body, i.e.
+// "Created", the 204 and 304 responses go without a body
+func (res *response) SendStatus(code int) {
+  res.header.SetStatus(code)
+  res.sendContent(code, "text/plain;charset=utf-8", []byte(http.StatusText(code)))
+}
+
+// NoContent sends a 204 No Content
+func (res *response) NoContent() {
+  res.SendStatus(204)
+}
+
 // Header returns response header
 func (res *response) Header() Header {
   return res.header
@@ -310,11 +432,25 @@ func (res *response) Cookie() Cookie {
   return res.cookie
 }
 
+// Locals returns the per-request store shared with the request
+func (res *response) Locals() *Locals {
+  return res.locals
+}
+
 // Render returns rendered HTML template
+// The "view engine" setting is used as extension if the file has none
+// The values from Locals are available to the template through the
+// "locals" function and are merged in case data is nil or a map,
+// the values in data take precedence over the locals
 func (res *response) Render(file string, data interface{}) {
-  tmpl, err := template.ParseFiles(file)
+  if engine := res.settings.String(SettingViewEngine); engine != "" && filepath.Ext(file) == "" {
+    file += "." + strings.TrimPrefix(engine, ".")
+  }
+  tmpl, err := template.New(filepath.Base(file)).Funcs(template.FuncMap{
+    "locals": res.locals.All,
+  }).ParseFiles(file)
   if err != nil {
-    log.Print("Template not found ", err)
+    log.Printf("[%s] Template not found %v", res.requestID(), err)
     res.header.SetStatus(500)
     res.header.FlushHeaders()
     res.End()
@@ -322,9 +458,9 @@ func (res *response) Render(file string, data interface{}) {
   }
 
   var tpl bytes.Buffer
-  err = tmpl.Execute(&tpl, data)
+  err = tmpl.Execute(&tpl, res.templateData(data))
   if err != nil {
-    log.Print("Template render failed ", err)
+    log.Printf("[%s] Template render failed %v", res.requestID(), err)
     res.header.SetStatus(500)
     res.header.FlushHeaders()
     res.End()
@@ -333,3 +469,17 @@ func (res *response) Render(file string, data interface{}) {
   res.WriteBytes(tpl.Bytes())
 }
 
+// templateData merges the response locals with the data passed to Render
+func (res *response) templateData(data interface{}) interface{} {
+  switch values := data.(type) {
+  case nil:
+    return res.locals.All()
+  case map[string]interface{}:
+    merged := res.locals.All()
+    for key, value := range values {
+      merged[key] = value
+    }
+    return merged
+  }
+  return data
+}
@@ -6,7 +6,9 @@
 package goexpress
 
 import (
+  "net/http"
   "regexp"
+  "sync"
 )
 
 // NextFunc is an extension type to help loop of lookup in express.go
@@ -17,9 +19,40 @@ type Middleware func(request Request, response Response)
 
 // A Route contains a regexp and a Router.Middleware type handler
 type Route struct {
+  path         string
   regex        *regexp.Regexp
   handler      Middleware
   isMiddleware bool
+  mutex        sync.Mutex
+  variants     map[routeOptions]*regexp.Regexp
+}
+
+// routeOptions are the route matching flags driven by the app settings
+type routeOptions struct {
+  caseSensitive bool
+  strict        bool
+}
+
+// defaultRouteOptions are the options routes are compiled with
+var defaultRouteOptions = routeOptions{caseSensitive: true, strict: false}
+
+// compiled returns the route regex for the given matching options,
+// the variants other than the default one are compiled on first use
+func (route *Route) compiled(options routeOptions) *regexp.Regexp {
+  if options == defaultRouteOptions || route.path == "" {
+    return route.regex
+  }
+  route.mutex.Lock()
+  defer route.mutex.Unlock()
+  if route.variants == nil {
+    route.variants = make(map[routeOptions]*regexp.Regexp)
+  }
+  regex, found := route.variants[options]
+  if !found {
+    regex = compileRoute(route.path, options)
+    route.variants[options] = regex
+  }
+  return regex
 }
 
 // router is a Collection of all method types routers
@@ -39,9 +72,10 @@ func newRouter() *router {
   return r
 }
 
-func (r *router) addHandler(method string, isMiddleware bool, url *regexp.Regexp, middleware Middleware) {
+func (r *router) addHandler(method string, isMiddleware bool, url string, middleware Middleware) {
   var route = &Route{}
-  route.regex = url
+  route.path = url
+  route.regex = CompileRegex(url)
   route.handler = middleware
   route.isMiddleware = isMiddleware
   r.routes[method] = append(r.routes[method], route)
@@ -49,64 +83,79 @@ func (r *router) addHandler(method string, isMiddleware bool, url *regexp.Regexp
 
 // Get function
 func (r *router) Get(url string, middleware Middleware) Router {
-  r.addHandler("get", false, CompileRegex(url), middleware)
+  r.addHandler("get", false, url, middleware)
   return r
 }
 
 // Post function
 func (r *router) Post(url string, middleware Middleware) Router {
-  r.addHandler("post", false, CompileRegex(url), middleware)
+  r.addHandler("post", false, url, middleware)
   return r
 }
 
 // Put function
 func (r *router) Put(url string, middleware Middleware) Router {
-  r.addHandler("put", false, CompileRegex(url), middleware)
+  r.addHandler("put", false, url, middleware)
   return r
 }
 
 // Patch function
 func (r *router) Patch(url string, middleware Middleware) Router {
-  r.addHandler("patch", false, CompileRegex(url), middleware)
+  r.addHandler("patch", false, url, middleware)
   return r
 }
 
 // Delete function
 func (r *router) Delete(url string, middleware Middleware) Router {
-  r.addHandler("delete", false, CompileRegex(url), middleware)
+  r.addHandler("delete", false, url, middleware)
   return r
 }
 
 // Options function
 func (r *router) Options(url string, middleware Middleware) Router {
-  r.addHandler("options", false, CompileRegex(url), middleware)
+  r.addHandler("options", false, url, middleware)
   return r
 }
 
 // Use can take a function or a new express.Router() instance as argument
+// net/http handlers and middlewares are adapted via HTTPHandler and HTTPMiddleware
 func (r *router) Use(middleware interface{}) Router {
-  // check if its another instance of the router
-  router, ok := middleware.(Router)
-  if ok {
-    r.useRouter(router)
-  } else {
-    mware, ok := middleware.(func(request Request, response Response))
-    if ok {
-      var regex = CompileRegex("(.*)")
-      // A middleware is for all type of routes
-      r.addHandler("get", true, regex, mware)
-      r.addHandler("post", true, regex, mware)
-      r.addHandler("put", true, regex, mware)
-      r.addHandler("patch", true, regex, mware)
-      r.addHandler("delete", true, regex, mware)
-      r.addHandler("options", true, regex, mware)
-    } else {
-      panic("express.Router.Use can only take a function or a Router instance")
-    }
+  switch handler := middleware.(type) {
+  case Router:
+    // its another instance of the router
+    r.useRouter(handler)
+  case Middleware:
+    r.useMiddleware(handler)
+  case func(request Request, response Response):
+    r.useMiddleware(handler)
+  case Handler:
+    r.useMiddleware(Handle(handler))
+  case func(request Request, response Response) error:
+    r.useMiddleware(Handle(handler))
+  case func(http.Handler) http.Handler:
+    r.useMiddleware(HTTPMiddleware(handler))
+  case func(http.ResponseWriter, *http.Request):
+    r.useMiddleware(HTTPHandlerFunc(handler))
+  case http.Handler:
+    r.useMiddleware(HTTPHandler(handler))
+  default:
+    panic("express.Router.Use can only take a function, a Router instance or a http.Handler")
   }
   return r
 }
 
+// useMiddleware adds a middleware for all type of routes
+func (r *router) useMiddleware(mware Middleware) *router {
+  var regex = "(.*)"
+  r.addHandler("get", true, regex, mware)
+  r.addHandler("post", true, regex, mware)
+  r.addHandler("put", true, regex, mware)
+  r.addHandler("patch", true, regex, mware)
+  r.addHandler("delete", true, regex, mware)
+  r.addHandler("options", true, regex, mware)
+  return r
+}
+
 func (r *router) useRouter(router Router) *router {
   routes := router.GetRoutes()
   for routeType, list := range routes {
@@ -124,13 +173,14 @@ func (r *router) GetRoutes() map[string][]*Route {
 
 // FindNext finds the suitable router for given url and method
 // It returns the middleware if found and a cursor index of array
-func (r *router) FindNext(index int, method string, url string, request *request) (Middleware, int, bool) {
+func (r *router) FindNext(index int, method string, url string, request *request, options routeOptions) (Middleware, int, bool) {
   var i = index
   for i < len(r.routes[method]) {
     var route = r.routes[method][i]
-    if route.regex.MatchString(url) {
-      var regex = route.regex.FindStringSubmatch(url)
-      for i, name := range route.regex.SubexpNames() {
+    var compiled = route.compiled(options)
+    if compiled.MatchString(url) {
+      var regex = compiled.FindStringSubmatch(url)
+      for i, name := range compiled.SubexpNames() {
         if name != "" {
           request.params.Set(name, regex[i])
         }
@@ -144,6 +194,25 @@ func (r *router) FindNext(index int, method string, url string, request *request
 
 // CompileRegex is a Helper which returns a golang RegExp for a given express route string
 func CompileRegex(url string) *regexp.Regexp {
+  return compileRoute(url, defaultRouteOptions)
+}
+
+// compileRoute returns the route regex honoring the case sensitivity
+// and the optional trailing slash of the matching options
+func compileRoute(url string, options routeOptions) *regexp.Regexp {
+  var flags = ""
+  var end = "(?:[\\/]{0,1})$"
+  if options.caseSensitive == false {
+    flags = "(?i)"
+  }
+  if options.strict {
+    end = "$"
+  }
+  return regexp.MustCompile(flags + routePattern(url) + end)
+}
+
+// routePattern converts an express route string to a regex pattern
+func routePattern(url string) string {
   var i = 0
   var buffer = "/"
   var regexStr = "^"
@@ -223,5 +292,5 @@ func CompileRegex(url string) *regexp.Regexp {
   if buffer != "" {
     regexStr += buffer
   }
-  return regexp.MustCompile(regexStr + "(?:[\\/]{0,1})$")
+  return regexStr
 }
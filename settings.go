@@ -0,0 +1,221 @@
+// Package goexpress settings holds the application wide configuration
+// Settings are safe to be read and written from multiple goroutines
+// and can be overridden from the environment, a setting "trust proxy"
+// is overridden by the GOEXPRESS_TRUST_PROXY environment variable
+// The environment is read when the app is created, see LoadEnv
+package goexpress
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// Well known setting keys understood by the framework
+const (
+  // SettingEnv is the environment the app runs in, "production" by default,
+  // "development" exposes the internal errors on the error pages
+  SettingEnv = "env"
+  // SettingTrustProxy is a comma separated list or a []string of the
+  // proxy addresses or CIDR ranges which are trusted to forward client info
+  SettingTrustProxy = "trust proxy"
+  // SettingSubdomainOffset is the number of the labels of the domain
+  // dropped by Request.Subdomains, 2 by default
+  SettingSubdomainOffset = "subdomain offset"
+  // SettingViewEngine is the default file extension used by Response.Render
+  // when the template path has none
+  SettingViewEngine = "view engine"
+  // SettingCaseSensitiveRouting makes "/Foo" and "/foo" different routes,
+  // enabled by default
+  SettingCaseSensitiveRouting = "case sensitive routing"
+  // SettingStrictRouting makes "/foo" and "/foo/" different routes,
+  // disabled by default
+  SettingStrictRouting = "strict routing"
+  // SettingJSONSpaces is the number of spaces used to indent Response.JSON
+  SettingJSONSpaces = "json spaces"
+  // SettingLog enables logging of every served request
+  SettingLog = "log"
+  // SettingRequestIDHeader is the header the request identifier is
+  // read from and echoed on, X-Request-ID by default
+  SettingRequestIDHeader = "request id header"
+  // SettingUploadDir is the directory the uploads too large for the
+  // memory are written to, the system temp directory by default
+  SettingUploadDir = "upload dir"
+)
+
+// settingsEnvPrefix is prepended to the environment variable names
+const settingsEnvPrefix = "GOEXPRESS_"
+
+// Settings is a concurrency safe registry of application settings
+type Settings struct {
+  mutex     sync.RWMutex
+  values    map[string]interface{}
+  overrides map[string]string // GOEXPRESS_ variables keyed by name
+  version   uint64            // bumped on every change
+}
+
+// newSettings returns the settings initialised with the defaults and
+// the environment overrides
+func newSettings() *Settings {
+  s := &Settings{values: make(map[string]interface{})}
+  s.values[SettingEnv] = "production"
+  s.values[SettingCaseSensitiveRouting] = true
+  s.values[SettingStrictRouting] = false
+  s.values[SettingJSONSpaces] = 0
+  s.values[SettingLog] = false
+  s.values[SettingSubdomainOffset] = 2
+  s.values[SettingRequestIDHeader] = "X-Request-ID"
+  return s.LoadEnv()
+}
+
+// LoadEnv reads the environment overrides again, they are read once
+// when the app is created
+func (s *Settings) LoadEnv() *Settings {
+  var overrides = make(map[string]string)
+  for _, pair := range os.Environ() {
+    if name, value, found := strings.Cut(pair, "="); found && strings.HasPrefix(name, settingsEnvPrefix) {
+      overrides[name] = value
+    }
+  }
+  s.mutex.Lock()
+  s.overrides = overrides
+  s.version++
+  s.mutex.Unlock()
+  return s
+}
+
+// settingEnvName returns the environment variable name of a setting
+func settingEnvName(key string) string {
+  name := strings.ToUpper(strings.TrimSpace(key))
+  name = strings.NewReplacer(" ", "_", "-", "_", ".", "_").Replace(name)
+  return settingsEnvPrefix + name
+}
+
+// Set a setting value
+func (s *Settings) Set(key string, value interface{}) *Settings {
+  s.mutex.Lock()
+  s.values[key] = value
+  s.version++
+  s.mutex.Unlock()
+  return s
+}
+
+// revision returns a number changing whenever the settings change, so
+// the values derived from them can be cached
+func (s *Settings) revision() uint64 {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+  return s.version
+}
+
+// Lookup returns a setting value and whether it was set, the value
+// of the environment variable takes precedence over the stored one
+func (s *Settings) Lookup(key string) (interface{}, bool) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+  if len(s.overrides) > 0 {
+    if value, found := s.overrides[settingEnvName(key)]; found {
+      return value, true
+    }
+  }
+  value, found := s.values[key]
+  return value, found
+}
+
+// Get returns a setting value, nil if it was never set
+func (s *Settings) Get(key string) interface{} {
+  value, _ := s.Lookup(key)
+  return value
+}
+
+// Enable sets a boolean setting to true
+func (s *Settings) Enable(key string) *Settings {
+  return s.Set(key, true)
+}
+
+// Disable sets a boolean setting to false
+func (s *Settings) Disable(key string) *Settings {
+  return s.Set(key, false)
+}
+
+// Enabled tells whether a boolean setting is true
+func (s *Settings) Enabled(key string) bool {
+  return s.Bool(key)
+}
+
+// String returns a setting as string
+func (s *Settings) String(key string) string {
+  switch value := s.Get(key).(type) {
+  case nil:
+    return ""
+  case string:
+    return value
+  default:
+    return fmt.Sprint(value)
+  }
+}
+
+// Bool returns a setting as bool, unparsable values are false
+func (s *Settings) Bool(key string) bool {
+  switch value := s.Get(key).(type) {
+  case bool:
+    return value
+  case string:
+    b, _ := strconv.ParseBool(strings.TrimSpace(value))
+    return b
+  case int:
+    return value != 0
+  }
+  return false
+}
+
+// Int returns a setting as int, unparsable values are 0
+func (s *Settings) Int(key string) int {
+  switch value := s.Get(key).(type) {
+  case int:
+    return value
+  case int64:
+    return int(value)
+  case float64:
+    return int(value)
+  case string:
+    i, _ := strconv.Atoi(strings.TrimSpace(value))
+    return i
+  }
+  return 0
+}
+
+// Duration returns a setting as time.Duration, strings are read
+// with time.ParseDuration and unparsable values are 0
+func (s *Settings) Duration(key string) time.Duration {
+  switch value := s.Get(key).(type) {
+  case time.Duration:
+    return value
+  case int:
+    return time.Duration(value)
+  case string:
+    d, _ := time.ParseDuration(strings.TrimSpace(value))
+    return d
+  }
+  return 0
+}
+
+// Strings returns a setting as a list, strings are split on comma
+func (s *Settings) Strings(key string) []string {
+  switch value := s.Get(key).(type) {
+  case []string:
+    return value
+  case string:
+    var list []string
+    for _, item := range strings.Split(value, ",") {
+      if item = strings.TrimSpace(item); item != "" {
+        list = append(list, item)
+      }
+    }
+    return list
+  }
+  return nil
+}
@@ -0,0 +1,41 @@
+package goexpress
+
+import (
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func Test_Settings_typed_getters_convert_values(t *testing.T) {
+  s := newSettings()
+  s.Set("timeout", "1s").Set("proxies", "10.0.0.0/8, 127.0.0.1").Set("count", "3")
+  assert.Equal(t, "production", s.String(SettingEnv))
+  assert.True(t, s.Enabled(SettingCaseSensitiveRouting))
+  assert.Equal(t, time.Second, s.Duration("timeout"))
+  assert.Equal(t, []string{"10.0.0.0/8", "127.0.0.1"}, s.Strings("proxies"))
+  assert.Equal(t, 3, s.Int("count"))
+  assert.Nil(t, s.Get("missing"))
+}
+
+func Test_Settings_environment_overrides_stored_values(t *testing.T) {
+  s := newSettings()
+  s.Set(SettingJSONSpaces, 4)
+  t.Setenv("GOEXPRESS_JSON_SPACES", "2")
+  t.Setenv("GOEXPRESS_STRICT_ROUTING", "true")
+  // the environment is read once
+  assert.Equal(t, 4, s.Int(SettingJSONSpaces))
+  s.LoadEnv()
+  assert.Equal(t, 2, s.Int(SettingJSONSpaces))
+  assert.True(t, s.Bool(SettingStrictRouting))
+  assert.Equal(t, 2, newSettings().Int(SettingJSONSpaces))
+}
+
+func Test_compileRoute_honors_routing_options(t *testing.T) {
+  regex := compileRoute("/users/:id", routeOptions{caseSensitive: false, strict: true})
+  assert.True(t, regex.MatchString("/Users/10"))
+  assert.False(t, regex.MatchString("/users/10/"))
+  regex = CompileRegex("/users/:id")
+  assert.False(t, regex.MatchString("/Users/10"))
+  assert.True(t, regex.MatchString("/users/10/"))
+}
@@ -0,0 +1,285 @@
+// Package goexpress sse streams server-sent events to the clients
+//
+// res.SSE() turns the response into an event stream kept alive by
+// heartbeats, the handler sends the events until the client goes away
+// and returns once Done is closed
+//
+//   app.Get("/events", func(req Request, res Response) {
+//     stream := res.SSE()
+//     defer stream.Close()
+//     stream.Retry(5 * time.Second)
+//     for _, missed := range history.Since(req.LastEventID()) {
+//       stream.Send("update", missed.ID, missed)
+//     }
+//     for {
+//       select {
+//       case update := <-updates:
+//         stream.Send("update", update.ID, update)
+//       case <-stream.Done():
+//         return
+//       }
+//     }
+//   })
+//
+// A Broker fans the events out to many streams.
+package goexpress
+
+import (
+  "encoding/json"
+  "errors"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// DefaultHeartbeat is the interval of the comments keeping an idle
+// event stream open through the proxies
+const DefaultHeartbeat = 15 * time.Second
+
+// ErrStreamClosed is returned when sending to a closed event stream
+var ErrStreamClosed = errors.New("goexpress: the event stream is closed")
+
+// ErrInvalidEventField is returned when the event name or id of an
+// event holds a line break, which would start another field
+var ErrInvalidEventField = errors.New("goexpress: the event name and id can not hold line breaks")
+
+// EventStream writes server-sent events to a client, it is safe to be
+// used from multiple goroutines
+type EventStream struct {
+  res       *response
+  mutex     sync.Mutex
+  done      chan struct{}
+  closeOnce sync.Once
+  ticker    *time.Ticker
+  stopped   chan struct{} // closed once the heartbeats stopped
+}
+
+// SSE starts an event stream on the response, the headers are sent
+// right away so they have to be set before
+func (res *response) SSE() *EventStream {
+  res.header.Set("Content-Type", "text/event-stream")
+  res.header.Set("Cache-Control", "no-cache")
+  // nginx buffers the responses otherwise
+  res.header.Set("X-Accel-Buffering", "no")
+  if res.header.BasicSent() == false {
+    res.cookie.Finish()
+    res.header.FlushHeaders()
+  }
+  stream := &EventStream{res: res, done: make(chan struct{}), ticker: time.NewTicker(DefaultHeartbeat), stopped: make(chan struct{})}
+  res.stream = stream
+  go stream.keepAlive(res.closeNotify())
+  return stream
+}
+
+// keepAlive sends the heartbeats until the client goes away
+func (s *EventStream) keepAlive(gone <-chan struct{}) {
+  defer close(s.stopped)
+  defer s.ticker.Stop()
+  for {
+    select {
+    case <-s.ticker.C:
+      if s.write([]byte(":\n\n")) != nil {
+        return
+      }
+    case <-gone:
+      s.finish()
+      return
+    case <-s.done:
+      return
+    }
+  }
+}
+
+// Heartbeat changes the interval of the heartbeats, zero stops them
+func (s *EventStream) Heartbeat(interval time.Duration) {
+  if interval <= 0 {
+    s.ticker.Stop()
+    return
+  }
+  s.ticker.Reset(interval)
+}
+
+// write sends a chunk unless the stream is closed, a failed write
+// closes the stream as the client went away
+func (s *EventStream) write(p []byte) error {
+  s.mutex.Lock()
+  select {
+  case <-s.done:
+    s.mutex.Unlock()
+    return ErrStreamClosed
+  default:
+  }
+  err := s.res.WriteBytes(p)
+  s.mutex.Unlock()
+  if err != nil {
+    s.finish()
+  }
+  return err
+}
+
+// Send sends an event, the event name and the id are left out when
+// empty, data is sent as is if it is a string or []byte and JSON
+// encoded otherwise, every line of data is sent as a data field
+// The event name and the id can not hold line breaks, see ErrInvalidEventField
+func (s *EventStream) Send(event string, id string, data interface{}) error {
+  if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n\x00") {
+    return ErrInvalidEventField
+  }
+  var payload string
+  switch value := data.(type) {
+  case string:
+    payload = value
+  case []byte:
+    payload = string(value)
+  default:
+    encoded, err := json.Marshal(value)
+    if err != nil {
+      return err
+    }
+    payload = string(encoded)
+  }
+  var message strings.Builder
+  if id != "" {
+    message.WriteString("id: " + id + "\n")
+  }
+  if event != "" {
+    message.WriteString("event: " + event + "\n")
+  }
+  // a lone "\r" ends a line as well
+  payload = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(payload)
+  for _, line := range strings.Split(payload, "\n") {
+    message.WriteString("data: " + line + "\n")
+  }
+  message.WriteString("\n")
+  return s.write([]byte(message.String()))
+}
+
+// Retry tells the client how long to wait before reconnecting
+func (s *EventStream) Retry(delay time.Duration) error {
+  return s.write([]byte("retry: " + strconv.FormatInt(delay.Milliseconds(), 10) + "\n\n"))
+}
+
+// Comment sends a comment line, ignored by the clients
+func (s *EventStream) Comment(text string) error {
+  return s.write([]byte(": " + strings.NewReplacer("\r", "", "\n", " ").Replace(text) + "\n\n"))
+}
+
+// Done returns a channel closed once the client went away or the
+// stream was closed
+func (s *EventStream) Done() <-chan struct{} {
+  return s.done
+}
+
+// finish marks the stream closed
+func (s *EventStream) finish() {
+  s.closeOnce.Do(func() {
+    s.mutex.Lock()
+    close(s.done)
+    s.mutex.Unlock()
+  })
+}
+
+// stop closes the stream and waits for the heartbeats to stop, so
+// nothing is written to the response anymore
+func (s *EventStream) stop() {
+  s.finish()
+  <-s.stopped
+}
+
+// Close closes the stream and ends the response
+func (s *EventStream) Close() {
+  s.stop()
+  s.res.End()
+}
+
+// LastEventID returns the id of the last event a reconnecting client
+// received, as sent in the Last-Event-ID header
+func (req *request) LastEventID() string {
+  return req.ref.Header.Get("Last-Event-ID")
+}
+
+// brokerQueueSize is the number of the events queued for a subscriber
+const brokerQueueSize = 64
+
+// brokerEvent is an event published to the subscribers
+type brokerEvent struct {
+  event string
+  id    string
+  data  interface{}
+}
+
+// Broker fans the published events out to the subscribed streams, a
+// stream is unsubscribed once its client goes away and the events are
+// dropped for a subscriber too slow to keep up
+//
+//   var broker = NewBroker()
+//   app.Get("/events", broker.Handler())
+//   broker.Publish("price", "", quote)
+type Broker struct {
+  mutex       sync.RWMutex
+  subscribers map[*EventStream]chan brokerEvent
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+  return &Broker{subscribers: make(map[*EventStream]chan brokerEvent)}
+}
+
+// Subscribe adds a stream to the broker
+func (b *Broker) Subscribe(stream *EventStream) {
+  queue := make(chan brokerEvent, brokerQueueSize)
+  b.mutex.Lock()
+  b.subscribers[stream] = queue
+  b.mutex.Unlock()
+  go func() {
+    defer b.Unsubscribe(stream)
+    for {
+      select {
+      case event := <-queue:
+        // a failed write closes the stream
+        stream.Send(event.event, event.id, event.data)
+      case <-stream.Done():
+        return
+      }
+    }
+  }()
+}
+
+// Unsubscribe removes a stream from the broker
+func (b *Broker) Unsubscribe(stream *EventStream) {
+  b.mutex.Lock()
+  delete(b.subscribers, stream)
+  b.mutex.Unlock()
+}
+
+// Len returns the number of the subscribed streams
+func (b *Broker) Len() int {
+  b.mutex.RLock()
+  defer b.mutex.RUnlock()
+  return len(b.subscribers)
+}
+
+// Publish sends an event to every subscribed stream, see EventStream.Send
+func (b *Broker) Publish(event string, id string, data interface{}) {
+  b.mutex.RLock()
+  defer b.mutex.RUnlock()
+  for _, queue := range b.subscribers {
+    select {
+    case queue <- brokerEvent{event: event, id: id, data: data}:
+    default:
+      // too slow, drop the event
+    }
+  }
+}
+
+// Handler returns a middleware subscribing the clients to the broker
+// until they go away
+func (b *Broker) Handler() Middleware {
+  return func(req Request, res Response) {
+    stream := res.SSE()
+    b.Subscribe(stream)
+    <-stream.Done()
+    stream.Close()
+  }
+}
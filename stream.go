@@ -0,0 +1,135 @@
+// Package goexpress stream gives an io.Writer view of the response body
+// so it can be handed to io.Copy, csv.Writer or json.Encoder
+//
+// The writes are buffered and sent as a chunk once the buffer is full
+// or on Flush, the headers can be changed until the first chunk is out.
+//
+//   w := res.Writer()
+//   encoder := csv.NewWriter(w)
+//   for _, row := range rows {
+//     encoder.Write(row)
+//   }
+//   encoder.Flush()
+//   res.End()
+package goexpress
+
+import (
+  "bufio"
+  "io"
+)
+
+// streamBufferSize is the size of the chunks sent by the BodyWriter
+const streamBufferSize = 32 * 1024
+
+// BodyWriter is a buffered writer of the response body
+type BodyWriter struct {
+  buffer *bufio.Writer
+}
+
+// chunkWriter sends every write as a chunk of the response body
+type chunkWriter struct {
+  res *response
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+  if c.res.header.BasicSent() == false {
+    c.res.cookie.Finish()
+    c.res.header.FlushHeaders()
+  }
+  if err := c.res.WriteBytes(p); err != nil {
+    return 0, err
+  }
+  return len(p), nil
+}
+
+// Writer returns the buffered writer of the response body, the data
+// left in the buffer is sent when the response ends
+func (res *response) Writer() *BodyWriter {
+  if res.body == nil {
+    res.body = &BodyWriter{buffer: bufio.NewWriterSize(chunkWriter{res: res}, streamBufferSize)}
+  }
+  return res.body
+}
+
+// Write buffers the data
+func (w *BodyWriter) Write(p []byte) (int, error) {
+  return w.buffer.Write(p)
+}
+
+// WriteString buffers a string
+func (w *BodyWriter) WriteString(s string) (int, error) {
+  return w.buffer.WriteString(s)
+}
+
+// ReadFrom copies a reader to the body, used by io.Copy
+func (w *BodyWriter) ReadFrom(r io.Reader) (int64, error) {
+  return w.buffer.ReadFrom(r)
+}
+
+// Flush sends the buffered data to the client
+func (w *BodyWriter) Flush() error {
+  return w.buffer.Flush()
+}
+
+// Stream calls the step function until it returns false or the client
+// goes away, the data written by a step is flushed once it returns and
+// the response is ended at the end, it returns true if the client went away
+// The request body has to be read before, see closeNotify
+//
+//   res.Stream(func(w io.Writer) bool {
+//     row, more := export.Next()
+//     json.NewEncoder(w).Encode(row)
+//     return more
+//   })
+func (res *response) Stream(step func(w io.Writer) bool) bool {
+  var gone = res.closeNotify()
+  var w = res.Writer()
+  defer res.End()
+  for {
+    select {
+    case <-gone:
+      return true
+    default:
+    }
+    keepOpen := step(w)
+    if err := w.Flush(); err != nil {
+      return true
+    }
+    if !keepOpen {
+      return false
+    }
+  }
+}
+
+// closeNotify returns a channel closed once the client closes the
+// connection, it reads and drops whatever the client sends after the
+// request body, which is closed so reading it fails afterwards
+func (res *response) closeNotify() <-chan struct{} {
+  res.closeOnce.Do(func() {
+    res.closed = make(chan struct{})
+    var body io.Closer
+    if req := res.request; req != nil {
+      if !req.bodyParsed {
+        req.bodyParsed = true
+        req.bodyError = ErrBodyConsumed
+      }
+      body = req.ref.Body
+    }
+    go func() {
+      if body != nil {
+        // drains the body before watching the connection
+        body.Close()
+      }
+      // net/http may still read the hijacked buffer to look for a
+      // pipelined request, the connection itself is read instead
+      var buffer = make([]byte, 512)
+      for {
+        if _, err := res.connection.Read(buffer); err != nil {
+          close(res.closed)
+          return
+        }
+      }
+    }()
+  })
+  return res.closed
+}
@@ -0,0 +1,411 @@
+// Package goexpress upload bounds what is read from the request bodies
+//
+// The app wide Limits are set with app.Limits() and can be replaced for
+// a route with the WithLimits middleware, the limits are enforced while
+// the body is read and a breach is answered with a 413 Payload Too Large
+// or a 415 Unsupported Media Type for the disallowed files by Body and
+// Files, the methods returning an error like ParseBody, Decode, Bind or
+// NextPart leave the answer to the handler. The type of
+// an uploaded file is sniffed from its content, the Content-Type sent by
+// the client is not trusted.
+package goexpress
+
+import (
+  "bufio"
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "io"
+  "log"
+  "math"
+  "mime/multipart"
+  "net/http"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// Unlimited turns off a limit, the zero value of a limit keeps the
+// default one
+const Unlimited = -1
+
+// Limits bounds the request body, a zero field takes the value of the
+// app limits, or DefaultLimits for the app ones, and Unlimited removes it
+type Limits struct {
+  // MaxBodySize is the total size of the body
+  MaxBodySize int64
+  // MaxFileSize is the size of each uploaded file
+  MaxFileSize int64
+  // MaxFiles is the number of uploaded files
+  MaxFiles int
+  // MaxFields is the number of form values
+  MaxFields int
+  // MaxFormSize is the total size of the multipart form values, which
+  // are kept in memory, each value is also bounded by MaxBufferSize
+  MaxFormSize int64
+  // MaxMemory is the size of the uploaded files kept in memory by Files,
+  // the rest is written to temporary files
+  MaxMemory int64
+  // AllowedTypes are the sniffed MIME types allowed for the uploaded
+  // files, "image/*" allows all the image types
+  AllowedTypes []string
+  // AllowedExtensions are the file name extensions allowed for the
+  // uploaded files, i.e. ".png"
+  AllowedExtensions []string
+  // MaxParams is the number of query string values
+  MaxParams int
+  // MaxDepth is the nesting depth of the query and form keys,
+  // a[b][c] is two levels deep
+  MaxDepth int
+  // MaxDecompressedSize is the size of a compressed body once
+  // decompressed, MaxBodySize bounds it as sent
+  MaxDecompressedSize int64
+  // MaxRawBodySize is the size of the body buffered by RawBody
+  MaxRawBodySize int64
+}
+
+// DefaultLimits are the limits of a new app
+var DefaultLimits = Limits{
+  MaxMemory:           MaxBufferSize,
+  MaxFields:           1000,
+  MaxFormSize:         MaxBufferSize,
+  MaxParams:           1000,
+  MaxDepth:            5,
+  MaxDecompressedSize: 10 * MaxBufferSize,
+  MaxRawBodySize:      MaxBufferSize,
+}
+
+// sniffLength is the number of bytes used to detect a file type
+const sniffLength = 512
+
+// withDefaults returns the limits with the zero fields set from base
+func (l Limits) withDefaults(base Limits) Limits {
+  if l.MaxBodySize == 0 {
+    l.MaxBodySize = base.MaxBodySize
+  }
+  if l.MaxFileSize == 0 {
+    l.MaxFileSize = base.MaxFileSize
+  }
+  if l.MaxFiles == 0 {
+    l.MaxFiles = base.MaxFiles
+  }
+  if l.MaxFields == 0 {
+    l.MaxFields = base.MaxFields
+  }
+  if l.MaxFormSize == 0 {
+    l.MaxFormSize = base.MaxFormSize
+  }
+  if l.MaxMemory == 0 {
+    l.MaxMemory = base.MaxMemory
+  }
+  if l.AllowedTypes == nil {
+    l.AllowedTypes = base.AllowedTypes
+  }
+  if l.AllowedExtensions == nil {
+    l.AllowedExtensions = base.AllowedExtensions
+  }
+  if l.MaxParams == 0 {
+    l.MaxParams = base.MaxParams
+  }
+  if l.MaxDepth == 0 {
+    l.MaxDepth = base.MaxDepth
+  }
+  if l.MaxDecompressedSize == 0 {
+    l.MaxDecompressedSize = base.MaxDecompressedSize
+  }
+  if l.MaxRawBodySize == 0 {
+    l.MaxRawBodySize = base.MaxRawBodySize
+  }
+  return l
+}
+
+// Limits sets the app wide request body limits, the zero fields keep
+// the DefaultLimits
+func (e *express) Limits(limits Limits) ExpressInterface {
+  e.limits = limits.withDefaults(DefaultLimits)
+  return e
+}
+
+// WithLimits returns a middleware replacing the body limits of the
+// requests it handles, the zero fields keep the app limits, it has to
+// run before the body is read
+//
+//   app.Post("/avatar", WithLimits(Limits{MaxFileSize: 1 << 20, AllowedTypes: []string{"image/*"}}))
+//   app.Post("/avatar", uploadAvatar)
+func WithLimits(limits Limits) Middleware {
+  return func(req Request, res Response) {
+    if err := req.SetLimits(limits); err != nil {
+      res.Fail(err)
+    }
+  }
+}
+
+// SetLimits replaces the body limits of the request, the zero fields
+// keep the app limits, it fails with ErrBodyConsumed once the body is read
+func (req *request) SetLimits(limits Limits) error {
+  if req.bodyParsed {
+    return ErrBodyConsumed
+  }
+  req.limits = limits.withDefaults(req.app.limits)
+  return nil
+}
+
+// openBody prepares the body for reading, enforcing the size limits,
+// decompressing it and converting the charset
+func (req *request) openBody() error {
+  req.bodyParsed = true
+  var httRequest = req.ref
+  if max := req.limits.MaxBodySize; max > 0 {
+    if httRequest.ContentLength > max {
+      req.bodyError = NewHTTPError(413, "Request body is too large")
+      return req.bodyError
+    }
+    httRequest.Body = &wrappedBody{
+      Reader: newLimitedReader(httRequest.Body, max, NewHTTPError(413, "Request body is too large")),
+      Closer: httRequest.Body,
+    }
+  }
+  if err := req.decodeContent(); err != nil {
+    req.bodyError = err
+    return err
+  }
+  if decoder, found := charsetDecoder(req.mimeParams["charset"]); !found {
+    req.bodyError = NewHTTPError(415, "Unsupported charset "+req.mimeParams["charset"])
+  } else if decoder != nil {
+    httRequest.Body = &wrappedBody{Reader: decoder(httRequest.Body), Closer: httRequest.Body}
+  }
+  return req.bodyError
+}
+
+// wrappedBody reads through a wrapping reader and closes the original body
+type wrappedBody struct {
+  io.Reader
+  io.Closer
+}
+
+// limitedReader fails with an error once more than the limit is read
+type limitedReader struct {
+  source    io.Reader
+  remaining int64
+  err       error
+}
+
+// newLimitedReader returns a reader failing with err after limit bytes
+func newLimitedReader(source io.Reader, limit int64, err error) *limitedReader {
+  return &limitedReader{source: source, remaining: limit, err: err}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+  if l.remaining < 0 {
+    return 0, l.err
+  }
+  if int64(len(p)) > l.remaining+1 {
+    p = p[:l.remaining+1]
+  }
+  n, err := l.source.Read(p)
+  if int64(n) <= l.remaining {
+    l.remaining -= int64(n)
+    return n, err
+  }
+  n = int(l.remaining)
+  l.remaining = -1
+  return n, l.err
+}
+
+// bodyError returns the HTTPError in the chain of a body read error,
+// any other error is a malformed body
+func bodyError(err error, message string) error {
+  var httpErr *HTTPError
+  if errors.As(err, &httpErr) {
+    return httpErr
+  }
+  return NewHTTPError(400, message).WithCause(err)
+}
+
+// readFormValue reads a multipart form value into the request body
+func (req *request) readFormValue(part *multipart.Part) error {
+  req.fieldCount++
+  if req.limits.MaxFields > 0 && req.fieldCount > req.limits.MaxFields {
+    return NewHTTPError(413, "Too many form fields")
+  }
+  var max = MaxBufferSize
+  if budget := req.limits.MaxFormSize; budget > 0 && budget-req.formSize < max {
+    max = budget - req.formSize
+  }
+  value, err := io.ReadAll(io.LimitReader(part, max+1))
+  if err != nil {
+    return bodyError(err, "Invalid multipart body")
+  } else if int64(len(value)) > max {
+    if max < MaxBufferSize {
+      return NewHTTPError(413, "Form values are too large")
+    }
+    return NewHTTPError(413, "Form value "+part.FormName()+" is too large")
+  }
+  req.formSize += int64(len(value))
+  req.body[part.FormName()] = append(req.body[part.FormName()], string(value))
+  return nil
+}
+
+// newUploadedFile checks a file part against the limits and returns
+// the file reading it
+func (req *request) newUploadedFile(part *multipart.Part) (*File, error) {
+  req.fileCount++
+  if req.limits.MaxFiles > 0 && req.fileCount > req.limits.MaxFiles {
+    return nil, NewHTTPError(413, "Too many files")
+  }
+  var name = part.FileName()
+  if len(req.limits.AllowedExtensions) > 0 && !containsFold(req.limits.AllowedExtensions, filepath.Ext(name)) {
+    return nil, NewHTTPError(415, "File extension of "+name+" is not allowed")
+  }
+  buffered := bufio.NewReaderSize(part, sniffLength)
+  head, err := buffered.Peek(sniffLength)
+  if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+    return nil, bodyError(err, "Invalid multipart body")
+  }
+  contentType, _ := parseMediaType(http.DetectContentType(head))
+  if len(req.limits.AllowedTypes) > 0 && !allowedType(req.limits.AllowedTypes, contentType) {
+    return nil, NewHTTPError(415, "File type "+contentType+" of "+name+" is not allowed")
+  }
+  file := &File{Name: name, FormName: part.FormName(), Mime: part.Header, Reader: part, ContentType: contentType}
+  file.reader = buffered
+  if req.limits.MaxFileSize > 0 {
+    file.reader = newLimitedReader(buffered, req.limits.MaxFileSize, NewHTTPError(413, "File "+name+" is too large"))
+  }
+  return file, nil
+}
+
+// ReadMultiPartBody reads a multipart form and populate the same in req params
+// Up to bufferSize bytes of the files are kept in memory, the limits
+// MaxMemory if zero, and the rest is written to temporary files
+func (req *request) ReadMultiPartBody(boundary string, bufferSize int64) error {
+  var memory = bufferSize
+  if memory == 0 {
+    memory = req.limits.MaxMemory
+  }
+  if memory == 0 {
+    memory = MaxBufferSize
+  } else if memory < 0 {
+    // never spilled to the disk
+    memory = math.MaxInt64 - 1
+  }
+  reader := multipart.NewReader(req.ref.Body, boundary)
+  for {
+    part, err := reader.NextPart()
+    if err == io.EOF {
+      return nil
+    } else if err != nil {
+      return bodyError(err, "Invalid multipart body")
+    }
+    if part.FileName() == "" {
+      if err = req.readFormValue(part); err != nil {
+        return err
+      }
+      continue
+    }
+    file, err := req.newUploadedFile(part)
+    if err != nil {
+      return err
+    }
+    var buffer bytes.Buffer
+    size, err := io.CopyN(&buffer, file.reader, memory+1)
+    if err != nil && err != io.EOF {
+      return bodyError(err, "Invalid multipart body")
+    }
+    if size > memory {
+      // too large for the memory left, spill it to the disk
+      temp, err := os.CreateTemp(req.app.settings.String(SettingUploadDir), "goexpress-upload-*")
+      if err != nil {
+        return err
+      }
+      req.tempFiles = append(req.tempFiles, temp.Name())
+      written, err := io.Copy(temp, io.MultiReader(&buffer, file.reader))
+      if err == nil {
+        _, err = temp.Seek(0, io.SeekStart)
+      }
+      if err != nil {
+        temp.Close()
+        return bodyError(err, "Invalid multipart body")
+      }
+      file.File, file.Size = temp, written
+    } else {
+      memory -= size
+      file.File, file.Size = memoryFile{bytes.NewReader(buffer.Bytes())}, size
+    }
+    file.reader = nil
+    req.files = append(req.files, file)
+  }
+}
+
+// removeTempFiles closes the uploaded files and removes the ones
+// written to the disk, it is called once the request is served
+func (req *request) removeTempFiles() {
+  for _, file := range req.files {
+    if file.File != nil {
+      file.File.Close()
+    }
+  }
+  for _, name := range req.tempFiles {
+    if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+      log.Printf("[%s] Failed to remove the upload %s: %v", req.id, name, err)
+    }
+  }
+  req.tempFiles = nil
+}
+
+// SaveTo writes the file content to path, the content is written to a
+// temporary file in the same directory first and renamed once complete
+// so path never holds a partial upload, SHA256 is set on success
+func (f *File) SaveTo(path string) error {
+  temp, err := os.CreateTemp(filepath.Dir(path), ".goexpress-upload-*")
+  if err != nil {
+    return err
+  }
+  defer os.Remove(temp.Name())
+  hash := sha256.New()
+  _, err = io.Copy(io.MultiWriter(temp, hash), f)
+  if err == nil {
+    err = temp.Sync()
+  }
+  if closeErr := temp.Close(); err == nil {
+    err = closeErr
+  }
+  if err == nil {
+    err = os.Rename(temp.Name(), path)
+  }
+  if err != nil {
+    return err
+  }
+  f.SHA256 = hex.EncodeToString(hash.Sum(nil))
+  return nil
+}
+
+// memoryFile is an uploaded file kept in memory
+type memoryFile struct {
+  *bytes.Reader
+}
+
+// Close is a no-op
+func (memoryFile) Close() error {
+  return nil
+}
+
+// containsFold tells if the list contains the value ignoring the case
+func containsFold(list []string, value string) bool {
+  for _, item := range list {
+    if strings.EqualFold(item, value) {
+      return true
+    }
+  }
+  return false
+}
+
+// allowedType tells if the media type matches one of the allowed types
+func allowedType(allowed []string, mediaType string) bool {
+  for _, item := range allowed {
+    if mediaTypeMatches(strings.ToLower(item), mediaType) {
+      return true
+    }
+  }
+  return false
+}
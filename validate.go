@@ -0,0 +1,336 @@
+// Package goexpress validate checks the struct fields as per their
+// `validate` tags, Request.Bind validates the struct once it is filled
+//
+//   type Signup struct {
+//     Email    string   `json:"email" validate:"required,email"`
+//     Name     string   `json:"name" validate:"required,min=2,max=64"`
+//     Plan     string   `json:"plan" validate:"oneof=free pro"`
+//     Handle   string   `json:"handle" validate:"omitempty,regex=^[a-z0-9_]+$"`
+//     Tags     []string `json:"tags" validate:"max=5,dive,min=1"`
+//     Address  *Address `json:"address" validate:"required"`
+//   }
+//
+// The rules are comma separated, so a regex can not contain a comma,
+// use \x2c instead. The rules following "dive" apply to every element
+// of a slice, array or map. Nested structs are always validated.
+package goexpress
+
+import (
+  "fmt"
+  "net/mail"
+  "net/url"
+  "reflect"
+  "regexp"
+  "strconv"
+  "strings"
+  "sync"
+  "unicode/utf8"
+)
+
+// FieldError describes a field which failed a validation rule
+type FieldError struct {
+  // Field is the path of the field as named in the json tags, i.e. items[0].name
+  Field string `json:"field"`
+  // Rule is the failed rule
+  Rule string `json:"rule"`
+  // Param is the rule parameter
+  Param string `json:"param,omitempty"`
+  // Message is a readable description of the failure
+  Message string `json:"message"`
+}
+
+// Error returns the field and the message
+func (e *FieldError) Error() string {
+  return e.Field + " " + e.Message
+}
+
+// ValidationErrors is the list of the fields which failed validation
+type ValidationErrors []*FieldError
+
+// Error returns all the field errors joined
+func (v ValidationErrors) Error() string {
+  messages := make([]string, len(v))
+  for i, err := range v {
+    messages[i] = err.Error()
+  }
+  return strings.Join(messages, "; ")
+}
+
+// HTTPError returns a 422 Unprocessable Entity listing the field errors
+func (v ValidationErrors) HTTPError() *HTTPError {
+  return NewHTTPError(422, "").WithDetail("errors", []*FieldError(v))
+}
+
+// ValidationFunc checks a field value against the rule parameter
+type ValidationFunc func(value reflect.Value, param string) bool
+
+var (
+  validationMutex sync.RWMutex
+  validations     = map[string]ValidationFunc{
+    "min":   validateMin,
+    "max":   validateMax,
+    "len":   validateLen,
+    "email": validateEmail,
+    "url":   validateURL,
+    "oneof": validateOneOf,
+    "regex": validateRegex,
+  }
+  validationMessages = map[string]string{
+    "required": "is required",
+    "min":      "must be at least %s",
+    "max":      "must be at most %s",
+    "len":      "must have a length of %s",
+    "email":    "must be a valid email address",
+    "url":      "must be a valid URL",
+    "oneof":    "must be one of %s",
+    "regex":    "must match %s",
+  }
+  regexCache sync.Map
+)
+
+// RegisterValidation adds a custom validation rule usable in the tags
+func RegisterValidation(rule string, check ValidationFunc) {
+  validationMutex.Lock()
+  validations[rule] = check
+  validationMutex.Unlock()
+}
+
+// Validate checks a struct or a pointer to a struct as per its `validate`
+// tags and returns ValidationErrors listing every field which failed
+func Validate(v interface{}) error {
+  value := reflect.ValueOf(v)
+  for value.Kind() == reflect.Ptr {
+    if value.IsNil() {
+      return nil
+    }
+    value = value.Elem()
+  }
+  if value.Kind() != reflect.Struct {
+    return nil
+  }
+  var errs ValidationErrors
+  validateStruct(value, "", &errs)
+  if len(errs) > 0 {
+    return errs
+  }
+  return nil
+}
+
+// fieldName returns the name of a field as seen by the clients
+func fieldName(field reflect.StructField) string {
+  for _, tag := range []string{"json", "form", "query", "param", "header"} {
+    if name := tagName(field, tag); name != "" {
+      return name
+    }
+  }
+  return field.Name
+}
+
+// validateStruct validates all the exported fields of a struct
+func validateStruct(value reflect.Value, path string, errs *ValidationErrors) {
+  valueType := value.Type()
+  for i := 0; i < valueType.NumField(); i++ {
+    field := valueType.Field(i)
+    if field.PkgPath != "" && !field.Anonymous {
+      continue
+    }
+    rules := field.Tag.Get("validate")
+    if rules == "-" {
+      continue
+    }
+    name := path
+    if !field.Anonymous {
+      name = joinFieldPath(path, fieldName(field))
+    }
+    var list []string
+    if rules != "" {
+      list = strings.Split(rules, ",")
+    }
+    validateValue(value.Field(i), name, list, errs)
+  }
+}
+
+// joinFieldPath appends a field name to a path
+func joinFieldPath(path string, name string) string {
+  if path == "" {
+    return name
+  }
+  return path + "." + name
+}
+
+// validateValue applies the rules to a value and validates the nested structs
+func validateValue(value reflect.Value, path string, rules []string, errs *ValidationErrors) {
+  for i, rule := range rules {
+    name, param := rule, ""
+    if index := strings.Index(rule, "="); index != -1 {
+      name, param = rule[:index], rule[index+1:]
+    }
+    switch name {
+    case "":
+      continue
+    case "omitempty":
+      if value.IsZero() {
+        return
+      }
+      continue
+    case "required":
+      if value.IsZero() {
+        *errs = append(*errs, newFieldError(path, name, param))
+        return
+      }
+      continue
+    case "dive":
+      elem := indirect(value)
+      switch elem.Kind() {
+      case reflect.Slice, reflect.Array:
+        for j := 0; j < elem.Len(); j++ {
+          validateValue(elem.Index(j), fmt.Sprintf("%s[%d]", path, j), rules[i+1:], errs)
+        }
+      case reflect.Map:
+        iter := elem.MapRange()
+        for iter.Next() {
+          validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), rules[i+1:], errs)
+        }
+      }
+      return
+    }
+    validationMutex.RLock()
+    check, found := validations[name]
+    validationMutex.RUnlock()
+    if !found {
+      panic("goexpress: unknown validation rule " + name)
+    }
+    elem := indirect(value)
+    if elem.IsValid() && !check(elem, param) {
+      *errs = append(*errs, newFieldError(path, name, param))
+      return
+    }
+  }
+  // descend in the nested structs
+  elem := indirect(value)
+  switch elem.Kind() {
+  case reflect.Struct:
+    if elem.Type() != timeType {
+      validateStruct(elem, path, errs)
+    }
+  case reflect.Slice, reflect.Array:
+    if kind := indirectType(elem.Type().Elem()).Kind(); kind == reflect.Struct {
+      for j := 0; j < elem.Len(); j++ {
+        validateValue(elem.Index(j), fmt.Sprintf("%s[%d]", path, j), nil, errs)
+      }
+    }
+  }
+}
+
+// newFieldError returns the error of a failed rule
+func newFieldError(path string, rule string, param string) *FieldError {
+  message, found := validationMessages[rule]
+  if !found {
+    message = "failed the " + rule + " validation"
+  } else if strings.Contains(message, "%s") {
+    message = fmt.Sprintf(message, param)
+  }
+  return &FieldError{Field: path, Rule: rule, Param: param, Message: message}
+}
+
+// indirect dereferences the pointers, nil pointers are invalid values
+func indirect(value reflect.Value) reflect.Value {
+  for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+    if value.IsNil() {
+      return reflect.Value{}
+    }
+    value = value.Elem()
+  }
+  return value
+}
+
+// indirectType dereferences the pointer types
+func indirectType(t reflect.Type) reflect.Type {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  return t
+}
+
+// compareSize compares the length of strings, slices and maps or the
+// value of numbers with the param, ok is false for unsupported values
+func compareSize(value reflect.Value, param string) (cmp int, ok bool) {
+  limit, err := strconv.ParseFloat(param, 64)
+  if err != nil {
+    panic("goexpress: invalid validation parameter " + param)
+  }
+  var size float64
+  switch value.Kind() {
+  case reflect.String:
+    size = float64(utf8.RuneCountInString(value.String()))
+  case reflect.Slice, reflect.Array, reflect.Map:
+    size = float64(value.Len())
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    size = float64(value.Int())
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    size = float64(value.Uint())
+  case reflect.Float32, reflect.Float64:
+    size = value.Float()
+  default:
+    return 0, false
+  }
+  switch {
+  case size < limit:
+    return -1, true
+  case size > limit:
+    return 1, true
+  }
+  return 0, true
+}
+
+func validateMin(value reflect.Value, param string) bool {
+  cmp, ok := compareSize(value, param)
+  return !ok || cmp >= 0
+}
+
+func validateMax(value reflect.Value, param string) bool {
+  cmp, ok := compareSize(value, param)
+  return !ok || cmp <= 0
+}
+
+func validateLen(value reflect.Value, param string) bool {
+  cmp, ok := compareSize(value, param)
+  return !ok || cmp == 0
+}
+
+func validateEmail(value reflect.Value, param string) bool {
+  if value.Kind() != reflect.String {
+    return false
+  }
+  address, err := mail.ParseAddress(value.String())
+  return err == nil && address.Address == value.String()
+}
+
+func validateURL(value reflect.Value, param string) bool {
+  if value.Kind() != reflect.String {
+    return false
+  }
+  parsed, err := url.ParseRequestURI(value.String())
+  return err == nil && parsed.Scheme != "" && parsed.Host != ""
+}
+
+func validateOneOf(value reflect.Value, param string) bool {
+  actual := fmt.Sprint(value.Interface())
+  for _, option := range strings.Fields(param) {
+    if option == actual {
+      return true
+    }
+  }
+  return false
+}
+
+func validateRegex(value reflect.Value, param string) bool {
+  if value.Kind() != reflect.String {
+    return false
+  }
+  cached, found := regexCache.Load(param)
+  if !found {
+    cached, _ = regexCache.LoadOrStore(param, regexp.MustCompile(param))
+  }
+  return cached.(*regexp.Regexp).MatchString(value.String())
+}
@@ -0,0 +1,62 @@
+package goexpress
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+type validateAddress struct {
+  City string `json:"city" validate:"required"`
+}
+
+type validateTarget struct {
+  Email     string             `json:"email" validate:"required,email"`
+  Name      string             `json:"name" validate:"min=2,max=5"`
+  Plan      string             `json:"plan" validate:"oneof=free pro"`
+  Handle    string             `json:"handle" validate:"omitempty,regex=^[a-z]+$"`
+  Website   string             `json:"website" validate:"omitempty,url"`
+  Tags      []string           `json:"tags" validate:"max=2,dive,len=3"`
+  Age       *int               `json:"age" validate:"required,min=18"`
+  Addresses []*validateAddress `json:"addresses"`
+}
+
+func Test_Validate_reports_every_failing_field(t *testing.T) {
+  age := 12
+  target := &validateTarget{
+    Email:     "not-an-email",
+    Name:      "r",
+    Plan:      "gold",
+    Handle:    "Rob!",
+    Website:   "example.com",
+    Tags:      []string{"abc", "toolong"},
+    Age:       &age,
+    Addresses: []*validateAddress{{City: "Pune"}, {}},
+  }
+  err := Validate(target)
+  errs, ok := err.(ValidationErrors)
+  if !assert.True(t, ok) {
+    return
+  }
+  var fields = map[string]string{}
+  for _, fieldErr := range errs {
+    fields[fieldErr.Field] = fieldErr.Rule
+  }
+  assert.Equal(t, map[string]string{
+    "email":             "email",
+    "name":              "min",
+    "plan":              "oneof",
+    "handle":            "regex",
+    "website":           "url",
+    "tags[1]":           "len",
+    "age":               "min",
+    "addresses[1].city": "required",
+  }, fields)
+  assert.Equal(t, 422, toHTTPError(err).Status)
+
+  age = 20
+  valid := &validateTarget{Email: "rob@example.com", Name: "rob", Plan: "pro", Age: &age}
+  assert.NoError(t, Validate(valid))
+  valid.Age = nil
+  assert.Equal(t, "age is required", Validate(valid).Error())
+}